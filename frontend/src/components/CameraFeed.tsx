@@ -18,7 +18,7 @@ export interface CameraFeedRef {
 }
 
 export const CameraFeed = forwardRef<CameraFeedRef, CameraFeedProps>(
-    ({ onDetectionResult, onError, captureInterval = 1000, hasActiveSession = false, onEndSession }, ref) => {
+    ({ onDetectionResult, onError, captureInterval = 1000, sessionId, hasActiveSession = false, onEndSession }, ref) => {
         const videoRef = useRef<HTMLVideoElement>(null);
         const canvasRef = useRef<HTMLCanvasElement>(null);
         const [isStreaming, setIsStreaming] = useState(false);
@@ -144,6 +144,10 @@ export const CameraFeed = forwardRef<CameraFeedRef, CameraFeedProps>(
                     is_drowsy: payload.is_drowsy,
                     drowsiness_score: payload.drowsiness_score,
                     alert_level: payload.alert_level,
+                    status: payload.status,
+                    status_label: payload.status_label,
+                    level: payload.level,
+                    level_label: payload.level_label,
                     inference_time_ms: payload.inference_time,
                     timestamp: payload.timestamp,
                     sequence_number: payload.sequence_number,
@@ -187,6 +191,23 @@ export const CameraFeed = forwardRef<CameraFeedRef, CameraFeedProps>(
             }
         }, [hasActiveSession]); // Подключаемся при изменении hasActiveSession
 
+        // привязка подключения к сессии: сервер сам сохраняет результаты кадров в сессию
+        useEffect(() => {
+            if (!sessionId) return;
+
+            const joinSession = () => {
+                wsService.send('JOIN_SESSION', { session_id: Number(sessionId) });
+            };
+            wsService.on('open', joinSession);
+            if (wsService.isConnected()) {
+                joinSession();
+            }
+
+            return () => {
+                wsService.off('open', joinSession);
+            };
+        }, [sessionId]);
+
         useEffect(() => {
             let intervalId: NodeJS.Timeout | null = null;
             if (isStreaming && captureInterval > 0) {
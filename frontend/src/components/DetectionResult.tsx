@@ -64,7 +64,11 @@ export const DetectionResult: React.FC<DetectionResultProps> = ({ result }) => {
 
         <div className="detection-item">
           <span className="detection-label">Уровень тревоги:</span>
-          <span className="detection-value">{result.alert_level}</span>
+          <span className="detection-value">
+            {result.status && result.status !== 'ok'
+              ? result.status_label
+              : result.level_label ?? result.alert_level}
+          </span>
         </div>
       </div>
 
@@ -2,7 +2,7 @@ import React, { useState, useRef, useEffect } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
 import { CameraFeed, type CameraFeedRef } from '../components/CameraFeed';
 import { DetectionResult } from '../components/DetectionResult';
-import { eventsAPI, sessionsAPI } from '../services/api';
+import { sessionsAPI } from '../services/api';
 import type { DetectionResultType } from '../types';
 import { Navbar } from '../components/Navbar';
 import { DecorativeElements } from '../components/DecorativeElements';
@@ -28,18 +28,9 @@ export const DetectionPage: React.FC = () => {
         }
     };
 
-    const handleDetectionResult = async (result: DetectionResultType) => {
+    // события сохраняет сервер: подключение привязано к сессии через JOIN_SESSION
+    const handleDetectionResult = (result: DetectionResultType) => {
         setDetectionResult(result);
-
-        try {
-            await eventsAPI.saveEvent({
-                session_id: sessionID,
-                drowsiness_score: result.drowsiness_score,
-                is_drowsy: result.is_drowsy,
-            });
-        } catch (error) {
-            console.error('Failed to save event:', error);
-        }
     };
 
     useEffect(() => {
@@ -77,6 +68,7 @@ export const DetectionPage: React.FC = () => {
                         ref={cameraFeedRef}
                         onDetectionResult={handleDetectionResult}
                         captureInterval={1000}
+                        sessionId={sessionID}
                         hasActiveSession={true}
                         onEndSession={handleEndSession}
                     />
@@ -2,8 +2,9 @@
 interface WebSocketMessage {
     type: string;
     payload?: any;
-    clientID?: string;
+    client_id?: string;
     timestamp?: number;
+    seq?: number;
 }
 
 type MessageHandler = (data: any) => void;
@@ -16,6 +17,9 @@ class WebSocketService {
     private maxReconnectAttempts = 10;
     private reconnectTimeout = 3000;
     private shouldReconnect = true;
+    // для возобновления после обрыва: сервер повторно пришлёт пропущенные результаты и тревоги
+    private clientId: string | null = null;
+    private lastSeq = 0;
 
     constructor(url?: string) {
         // относительный URL для WebSocket, чтобы cookies отправлялись автоматически
@@ -36,10 +40,15 @@ class WebSocketService {
 
         this.shouldReconnect = true;
         this.reconnectAttempts = 0;
-        console.log('Attempting WebSocket connection to:', this.url);
-        this.ws = new WebSocket(this.url);
+        const url = this.clientId
+            ? `${this.url}?clientId=${encodeURIComponent(this.clientId)}&last_seq=${this.lastSeq}`
+            : this.url;
+        console.log('Attempting WebSocket connection to:', url);
+        this.ws = new WebSocket(url);
+        let opened = false;
 
         this.ws.onopen = () => {
+            opened = true;
             console.log('WebSocket connected, readyState:', this.ws?.readyState);
             this.reconnectAttempts = 0;
             this.trigger('open');
@@ -62,7 +71,8 @@ class WebSocketService {
             console.log('WebSocket disconnected:', event.code, event.reason, 'clean:', event.wasClean);
             this.ws = null;
 
-            if (event.code === 1006 || event.code === 1008 || event.code === 1002) {
+            // 1006 без установленного соединения - отказ при подключении, после него - обрыв сети
+            if ((event.code === 1006 && !opened) || event.code === 1008 || event.code === 1002) {
                 console.log('WebSocket connection rejected by server (likely authentication issue). Stopping reconnection.');
                 this.shouldReconnect = false;
             }
@@ -86,6 +96,20 @@ class WebSocketService {
     }
 
     private handleMessage(message: WebSocketMessage) {
+        if (message.type === 'WELCOME' && message.client_id) {
+            this.clientId = message.client_id;
+            this.lastSeq = 0;
+        }
+        // пропущенные сообщения уже вытеснены из буфера сервера: подписчики RESUMED
+        // должны заново загрузить состояние, дальнейшая нумерация идёт от last_seq
+        if (message.type === 'RESUMED' && message.payload?.resync) {
+            this.lastSeq = message.payload.last_seq;
+        }
+        if (message.seq) {
+            // повторно присланное сообщение уже обработано
+            if (message.seq <= this.lastSeq) return;
+            this.lastSeq = message.seq;
+        }
         const handlers = this.messageHandlers.get(message.type) || [];
         handlers.forEach((handler) => handler(message.payload));
     }
@@ -125,6 +149,8 @@ class WebSocketService {
 
     disconnect() {
         this.shouldReconnect = false;
+        this.clientId = null;
+        this.lastSeq = 0;
         if (this.ws) {
             this.ws.close();
             this.ws = null;
@@ -20,16 +20,27 @@ export interface Event {
   drowsiness_score: number;
   is_drowsy: boolean;
   timestamp: string;
+  perclos?: number;
+  blink_rate?: number;
+  long_blinks?: number;
 }
 
 export interface DetectionResult {
   is_drowsy: boolean;
   drowsiness_score: number;
   alert_level: string;
+  status?: string;
+  status_label?: string;
+  level?: string;
+  level_label?: string;
   inference_time_ms?: number;
   timestamp?: number;
   inference_time?: number;
   sequence_number?: number;
+  perclos?: number;
+  blink_rate?: number;
+  blinks?: number;
+  long_blinks?: number;
 }
 
 export interface CreateSessionRequest {
@@ -40,5 +51,8 @@ export interface CreateEventRequest {
   session_id: number;
   drowsiness_score: number;
   is_drowsy: boolean;
+  perclos?: number;
+  blink_rate?: number;
+  long_blinks?: number;
 }
 
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"AI_DETECTOR/go-backend/internal/config"
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/services"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Импорт сеансов из NDJSON-выгрузки в базу текущего окружения.
+//
+//	go run ./cmd/import -file sessions.ndjson -user 42
+//	go run ./cmd/import -file backup.ndjson.gz -keep-owner
+func main() {
+	file := flag.String("file", "-", "NDJSON file to import (- for stdin, .gz is decompressed)")
+	userID := flag.Int("user", 0, "Assign all imported sessions to this user ID")
+	keepOwner := flag.Bool("keep-owner", false, "Keep user_id from the archive instead of -user")
+	flag.Parse()
+
+	if *userID == 0 && !*keepOwner {
+		log.Fatal("Either -user or -keep-owner is required")
+	}
+	if *userID != 0 && *keepOwner {
+		log.Fatal("-user and -keep-owner are mutually exclusive")
+	}
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", *file, err)
+		}
+		defer f.Close()
+		in = f
+
+		if strings.HasSuffix(*file, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				log.Fatalf("Failed to read gzip %s: %v", *file, err)
+			}
+			defer gz.Close()
+			in = gz
+		}
+	}
+
+	cfg := config.LoadConfig()
+	if err := database.InitDB(cfg); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.CloseDB()
+
+	// Оператор CLI явно выбирает владельца, поэтому чужие user_id допускаются
+	report, err := services.ImportSessions(context.Background(), database.DB, in, services.ImportOptions{
+		UserID:            *userID,
+		AllowForeignOwner: true,
+	})
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+
+	if err != nil {
+		log.Fatalf("Import stopped: %v", err)
+	}
+	log.Printf("Imported %d sessions, %d events; %d duplicates, %d in trash, %d rejected",
+		report.SessionsImported, report.EventsImported, len(report.Duplicates), len(report.InTrash), len(report.Rejected))
+}
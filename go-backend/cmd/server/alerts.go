@@ -0,0 +1,268 @@
+package main
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	alertStore           *services.AlertStore
+	defaultAlertSettings models.AlertSettings
+	escalationChain      []services.EscalationStep
+)
+
+// Создаёт покадровый классификатор и движок эпизодов по настройкам тревоги пользователя.
+// Настройки читаются при подключении; изменения действуют со следующего подключения
+func newClientAlerts(userID int) (*services.DrowsinessClassifier, *services.AlertEngine) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	settings, err := services.ResolveAlertSettings(ctx, database.DB, userID, defaultAlertSettings)
+	if err != nil {
+		log.Printf("Failed to load alert settings for user %d, using defaults: %v", userID, err)
+	}
+	return services.NewDrowsinessClassifier(settings),
+		services.NewAlertEngine(services.AlertEngineConfigFor(settings))
+}
+
+// Сохраняет переход тревоги и публикует его в поток сеанса (SSE).
+// Возвращает false, если тревога подавлена правилом и клиенту её отправлять не нужно
+func recordAlertTransition(client *WebSocketClient, tr *services.AlertTransition) bool {
+	ep := tr.Episode
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if suppressAlertTransition(ctx, client, tr) {
+		return false
+	}
+
+	eventType, webhookEvent := services.SessionEventAlertStart, models.WebhookAlertStart
+	if tr.Type == services.AlertStarted {
+		ep.UserID = client.userID
+		ep.ClientID = client.clientID
+		if id, ok := client.boundSession(); ok {
+			ep.SessionID = &id
+		}
+		if err := alertStore.Open(ctx, ep); err != nil {
+			log.Printf("Failed to save alert episode for client %s: %v", client.clientID, err)
+		}
+	} else {
+		eventType, webhookEvent = services.SessionEventAlertEnd, models.WebhookAlertEnd
+		if ep.ID != 0 {
+			if err := alertStore.Close(ctx, ep); err != nil {
+				log.Printf("Failed to close alert episode %d: %v", ep.ID, err)
+			}
+		}
+	}
+
+	if ep.SessionID != nil {
+		services.GetSessionEventBus().Publish(*ep.SessionID, eventType, *ep)
+	}
+	if err := services.PublishEvent(ctx, database.DB, client.userID, webhookEvent, *ep); err != nil {
+		log.Printf("Failed to publish alert event for client %s: %v", client.clientID, err)
+	}
+	go publishSupervisorEvent(supervisorEvent{
+		Event:    eventType,
+		UserID:   client.userID,
+		ClientID: client.clientID,
+		Severity: ep.Severity,
+		Data:     *ep,
+	})
+	log.Printf("Alert %s (%s) for client %s: peak %.2f, severity %s",
+		tr.Type, ep.AlertType, client.clientID, ep.PeakScore, ep.Severity)
+	return true
+}
+
+// Сохраняет переход и отправляет клиенту ALERT_START / ALERT_END, тип тревоги - в alert_type.
+// Начало тревоги о сонливости запускает эскалацию, окончание - останавливает её
+func handleAlertTransition(client *WebSocketClient, tr *services.AlertTransition) {
+	if tr == nil {
+		return
+	}
+	if !recordAlertTransition(client, tr) {
+		return
+	}
+	if tr.Episode.AlertType == models.AlertTypeDrowsiness {
+		if tr.Type == services.AlertStarted {
+			client.escalation.Start(*tr.Episode)
+		} else {
+			client.escalation.Stop()
+		}
+	}
+
+	msgType := "ALERT_START"
+	if tr.Type == services.AlertEnded {
+		msgType = "ALERT_END"
+	}
+	trySend(client, WebSocketMessage{
+		Type:      msgType,
+		ClientID:  client.clientID,
+		Timestamp: time.Now().Unix(),
+		Payload:   *tr.Episode,
+	})
+}
+
+// Отправляет сообщение клиенту, не блокируя вызывающего: цикл чтения, обработчик кадров
+// или таймер эскалации. Канал send водителя не закрывается, поэтому отправка безопасна.
+// Результаты и тревоги нумеруются и сохраняются для повторной отправки, в том числе пока
+// клиент отключён и ожидает переподключения
+func trySend(client *WebSocketClient, msg WebSocketMessage) {
+	if client.replay != nil {
+		client.replay.mu.Lock()
+		defer client.replay.mu.Unlock()
+		if replayableMessages[msg.Type] {
+			client.replay.record(&msg)
+		}
+	}
+	if atomic.LoadInt32(&client.closed) != 0 {
+		return
+	}
+	select {
+	case client.send <- msg:
+	default:
+		log.Printf("Send buffer full for client %s, dropping %s", client.clientID, msg.Type)
+	}
+}
+
+func newClientEscalation(client *WebSocketClient) *services.AlertEscalation {
+	return services.NewAlertEscalation(escalationChain, func(evt models.AlertEscalationEvent) {
+		escalateAlert(client, evt)
+	})
+}
+
+// Выполняет шаг эскалации неподтверждённой тревоги
+func escalateAlert(client *WebSocketClient, evt models.AlertEscalationEvent) {
+	// С запасом на повторы отправки экстренному контакту
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	log.Printf("Escalating alert %d for client %s: level %d (%s)", evt.Episode.ID, client.clientID, evt.Level, evt.Action)
+	if evt.Episode.ID != 0 {
+		if err := alertStore.RecordEscalation(ctx, evt.Episode.ID, evt.Level, evt.Action); err != nil {
+			log.Printf("Failed to save escalation of alert %d: %v", evt.Episode.ID, err)
+		}
+	}
+
+	msgType := "ALERT_ESCALATED"
+	switch evt.Action {
+	case models.EscalationRepeat:
+		msgType = "ALERT_REPEAT"
+	case models.EscalationManager:
+		if err := services.PublishEvent(ctx, database.DB, client.userID, models.WebhookAlertEscalated, evt); err != nil {
+			log.Printf("Failed to publish escalation for client %s: %v", client.clientID, err)
+		}
+	case models.EscalationEmergency:
+		notifyEmergencyContact(ctx, client.userID, evt)
+	}
+	trySend(client, WebSocketMessage{
+		Type:      msgType,
+		ClientID:  client.clientID,
+		Timestamp: time.Now().Unix(),
+		Payload:   evt,
+	})
+
+	publishSupervisorEvent(supervisorEvent{
+		Event:    supervisorEventAlertEscalated,
+		UserID:   client.userID,
+		ClientID: client.clientID,
+		Severity: evt.Episode.Severity,
+		Data:     evt,
+	})
+}
+
+func notifyEmergencyContact(ctx context.Context, userID int, evt models.AlertEscalationEvent) {
+	contact, err := services.LoadEmergencyContact(ctx, database.DB, userID)
+	if err != nil {
+		log.Printf("Failed to load emergency contact of user %d: %v", userID, err)
+		return
+	}
+	if contact == nil {
+		log.Printf("Alert %d escalated to emergency, but user %d has no emergency contact", evt.Episode.ID, userID)
+		return
+	}
+	ns := services.GetNotificationService()
+	if ns == nil {
+		return
+	}
+	_, username, _, err := loadUserScope(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user %d: %v", userID, err)
+	}
+	err = ns.SendDirect(ctx, contact.Channel, contact.Target, services.NotificationData{
+		Event:    models.NotificationAlertEmergency,
+		UserID:   userID,
+		Username: username,
+		Time:     time.Now(),
+		Data:     evt,
+	})
+	if err != nil {
+		log.Printf("Failed to notify emergency contact of user %d via %s: %v", userID, contact.Channel, err)
+		return
+	}
+	log.Printf("Emergency contact of user %d notified via %s", userID, contact.Channel)
+}
+
+// Подтверждение тревоги водителем: {"type": "ACK", "payload": {"episode_id": 1}}.
+// Без episode_id подтверждается последняя тревога
+func handleAck(client *WebSocketClient, payload json.RawMessage) {
+	var req struct {
+		EpisodeID int `json:"episode_id"`
+	}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			sendError(client, "Invalid ACK payload")
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	ack, err := client.escalation.Ack(req.EpisodeID, now)
+	if err != nil {
+		sendError(client, err.Error())
+		return
+	}
+
+	if ack.Episode.ID != 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		if err := alertStore.Acknowledge(ctx, ack.Episode.ID, now, ack.Latency); err != nil {
+			log.Printf("Failed to save acknowledgement of alert %d: %v", ack.Episode.ID, err)
+		}
+		cancel()
+	}
+	log.Printf("Alert %d acknowledged by client %s after %v (escalation level %d)",
+		ack.Episode.ID, client.clientID, ack.Latency, ack.Level)
+
+	result := map[string]interface{}{
+		"episode_id":       ack.Episode.ID,
+		"latency_ms":       ack.Latency.Milliseconds(),
+		"escalation_level": ack.Level,
+	}
+	trySend(client, WebSocketMessage{
+		Type:      "ACK_OK",
+		ClientID:  client.clientID,
+		Timestamp: time.Now().Unix(),
+		Payload:   result,
+	})
+	go publishSupervisorEvent(supervisorEvent{
+		Event:    supervisorEventAlertAck,
+		UserID:   client.userID,
+		ClientID: client.clientID,
+		Severity: ack.Episode.Severity,
+		Data:     result,
+	})
+}
+
+func sendError(client *WebSocketClient, message string) {
+	trySend(client, WebSocketMessage{
+		Type:      "ERROR",
+		ClientID:  client.clientID,
+		Timestamp: time.Now().Unix(),
+		Payload:   map[string]interface{}{"message": message},
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/pkg/pb"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// Подпротоколы /ws (Sec-WebSocket-Protocol). Без подпротокола или с JSON-подпротоколом
+// кадры приходят в FRAME с base64; бинарный подпротокол дополнительно разрешает
+// бинарные сообщения с кадром. Остальные сообщения в обоих случаях - JSON
+const (
+	wsProtocolJSON   = "drowsiness.json.v1"
+	wsProtocolBinary = "drowsiness.binary.v1"
+)
+
+// Бинарный кадр: заголовок big-endian, за ним - байты JPEG
+//
+//	0     version uint8 (1)
+//	1     flags uint8 (зарезервировано, 0)
+//	2-3   stream_id uint16
+//	4-7   sequence_number uint32
+//	8-15  timestamp int64, мс
+const (
+	binaryFrameVersion    = 1
+	binaryFrameHeaderSize = 16
+	// Предел размера сообщения клиента: кадр в base64 с запасом на JSON
+	maxClientMessageBytes = 8 << 20
+)
+
+// Входящее сообщение клиента: payload разбирается обработчиком своего типа
+type incomingMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Кадр видео клиента независимо от способа передачи
+type incomingFrame struct {
+	StreamID uint16
+	Frame    *pb.VideoFrame
+}
+
+func decodeBinaryFrame(data []byte) (incomingFrame, error) {
+	if len(data) < binaryFrameHeaderSize {
+		return incomingFrame{}, fmt.Errorf("binary frame is shorter than %d-byte header", binaryFrameHeaderSize)
+	}
+	if data[0] != binaryFrameVersion {
+		return incomingFrame{}, fmt.Errorf("unsupported binary frame version %d", data[0])
+	}
+	jpeg := data[binaryFrameHeaderSize:]
+	if len(jpeg) == 0 {
+		return incomingFrame{}, fmt.Errorf("empty frame data")
+	}
+	return incomingFrame{
+		StreamID: binary.BigEndian.Uint16(data[2:4]),
+		Frame: &pb.VideoFrame{
+			FrameData:      jpeg,
+			SequenceNumber: int32(binary.BigEndian.Uint32(data[4:8])),
+			Timestamp:      int64(binary.BigEndian.Uint64(data[8:16])),
+		},
+	}, nil
+}
+
+func decodeJSONFrame(payload json.RawMessage) (incomingFrame, error) {
+	var frameData models.WSFrameMessage
+	if err := json.Unmarshal(payload, &frameData); err != nil {
+		return incomingFrame{}, fmt.Errorf("invalid frame data format")
+	}
+	frameBytes, err := base64.StdEncoding.DecodeString(frameData.Frame)
+	if err != nil {
+		return incomingFrame{}, fmt.Errorf("invalid base64")
+	}
+	if len(frameBytes) == 0 {
+		return incomingFrame{}, fmt.Errorf("empty frame data")
+	}
+	return incomingFrame{
+		StreamID: frameData.StreamID,
+		Frame: &pb.VideoFrame{
+			FrameData:      frameBytes,
+			Timestamp:      frameData.Timestamp,
+			SequenceNumber: frameData.SequenceNumber,
+		},
+	}, nil
+}
@@ -8,8 +8,11 @@ import (
 	"AI_DETECTOR/go-backend/internal/services"
 	"AI_DETECTOR/go-backend/pkg/pb"
 	"context"
-	"encoding/base64"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"github.com/gorilla/websocket"
 	"google.golang.org/grpc"
@@ -19,6 +22,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -33,17 +37,50 @@ var (
 	appConfig       *config.Config
 	serverStartTime time.Time
 
+	eyeMetricsConfig  services.EyeMetricsConfig
+	frameQueueSize    int
+	distractionConfig services.DistractionConfig
+
 	wsClients = &WebSocketClients{
 		clients: make(map[string]*WebSocketClient),
 	}
+	// Обработчики подключений водителей; при остановке сервера их дожидаются
+	driverConnections sync.WaitGroup
+	shuttingDown      atomic.Bool
 )
 
 type WebSocketClient struct {
-	conn     *websocket.Conn
-	clientID string
-	send     chan interface{}
-	mu       sync.Mutex
-	closed   int32 // Атомарный флаг для отслеживания закрытия
+	conn        *websocket.Conn
+	clientID    string
+	userID      int
+	send        chan interface{}
+	mu          sync.Mutex
+	closed      int32 // Атомарный флаг для отслеживания закрытия
+	alerts      *services.AlertEngine
+	distraction *services.DistractionAnalyzer
+	decider     *services.DrowsinessClassifier
+	eyes        *services.EyeMetricsAnalyzer
+	escalation  *services.AlertEscalation
+	// Подавленные правилом текущие эпизоды: тип тревоги -> ID записи в suppressed_alerts
+	suppressed map[string]int
+	// Язык подписей статуса и уровня тревоги: ?lang= или Accept-Language
+	lang string
+	// Согласован бинарный подпротокол: кадры можно присылать бинарными сообщениями
+	binary bool
+	// Очередь кадров на обработку; у супервизоров nil
+	frames *framePipeline
+	// Задан для подключений супервизоров (/ws/supervisor), у водителей nil
+	supervisor *supervisorState
+	// Привязанный сеанс (под mu) и признак, что сеанс начат этим подключением
+	sessionID      int
+	sessionStarted bool
+	// Буфер повторной отправки результатов и тревог; у супервизоров nil
+	replay *replayBuffer
+	// Текущее соединение водителя: stop останавливает writePump, writerDone закрывается
+	// при его выходе, released - когда соединение освобождено и клиент можно возобновить
+	stop       chan struct{}
+	writerDone chan struct{}
+	released   chan struct{}
 }
 
 type WebSocketClients struct {
@@ -57,6 +94,8 @@ type WebSocketMessage struct {
 	Payload   interface{} `json:"payload"`
 	ClientID  string      `json:"client_id,omitempty"`
 	Timestamp int64       `json:"timestamp"`
+	// Номер результата или тревоги для возобновления после переподключения (?last_seq=)
+	Seq uint64 `json:"seq,omitempty"`
 }
 
 func enableCORS(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
@@ -173,6 +212,109 @@ func main() {
 	defer database.CloseDB()
 	log.Println("Database initialized successfully")
 
+	// Контекст фоновых заданий, отменяется при остановке
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	retention := services.NewRetentionService(database.DB, cfg.ArchiveDir, cfg.RetentionDays,
+		time.Duration(cfg.RetentionCheckInterval)*time.Minute)
+	go retention.Start(bgCtx)
+
+	trashRetention := time.Duration(cfg.SessionPurgeAfterDays) * 24 * time.Hour
+	handlers.SetTrashRetention(trashRetention)
+	handlers.SetSingleActiveSession(cfg.SingleActiveSession)
+	shareSecret := []byte(cfg.ShareSecret)
+	if len(shareSecret) == 0 {
+		// Без заданного ключа ссылки перестают действовать после перезапуска
+		shareSecret = make([]byte, 32)
+		if _, err := rand.Read(shareSecret); err != nil {
+			log.Fatalf("Failed to generate share secret: %v", err)
+		}
+		log.Println("WARNING: SHARE_SECRET is not set, share links will not survive restart")
+	}
+	handlers.SetShareSecret(shareSecret)
+	purger := services.NewSessionPurger(database.DB, trashRetention,
+		time.Duration(cfg.SessionPurgeInterval)*time.Minute)
+	go purger.Start(bgCtx)
+	go services.GetSessionEventBus().StartJanitor(bgCtx, time.Hour)
+
+	services.SetAllowPrivateTargets(cfg.WebhookAllowPrivateTargets)
+	webhooks := services.NewWebhookDispatcher(database.DB,
+		time.Duration(cfg.WebhookPollIntervalSec)*time.Second,
+		time.Duration(cfg.WebhookTimeoutSec)*time.Second,
+		cfg.WebhookMaxAttempts)
+	go webhooks.Start(bgCtx)
+
+	// Email и чат-бот включаются, только если заданы их параметры
+	notifyTimeout := time.Duration(cfg.NotificationTimeoutSec) * time.Second
+	notifiers := []services.Notifier{services.NewWebhookNotifier(notifyTimeout, cfg.NotificationSecret)}
+	if cfg.SMTPHost != "" && cfg.SMTPFrom != "" {
+		notifiers = append(notifiers, services.NewSMTPNotifier(services.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		}, notifyTimeout))
+	}
+	if cfg.ChatBotToken != "" {
+		notifiers = append(notifiers, services.NewChatBotNotifier(cfg.ChatBotAPIURL, cfg.ChatBotToken, notifyTimeout))
+	}
+	notifications := services.NewNotificationService(database.DB, notifyTimeout, cfg.NotificationWorkers, notifiers...)
+	services.SetNotificationService(notifications)
+	go notifications.Start(bgCtx)
+
+	alertStore = services.NewAlertStore(database.DB)
+	suppressionStore = services.NewSuppressionStore(database.DB)
+	chain, chainErr := services.ParseEscalationChain(cfg.EscalationChain)
+	if chainErr != nil {
+		log.Fatalf("Invalid ESCALATION_CHAIN: %v", chainErr)
+	}
+	escalationChain = chain
+	switch cfg.ScoreSmoothing {
+	case models.SmoothingNone, models.SmoothingEMA, models.SmoothingMedian:
+	default:
+		log.Fatalf("Invalid SCORE_SMOOTHING %q: expected none, ema or median", cfg.ScoreSmoothing)
+	}
+	defaultAlertSettings = models.AlertSettings{
+		ScoreThreshold:  cfg.AlertScoreThreshold,
+		MinDurationMs:   cfg.AlertMinDurationMs,
+		CooldownSec:     cfg.AlertCooldownSec,
+		SmoothingMethod: cfg.ScoreSmoothing,
+		SmoothingAlpha:  cfg.ScoreSmoothingAlpha,
+		SmoothingWindow: cfg.ScoreSmoothingWindow,
+		Hysteresis:      cfg.AlertHysteresis,
+	}
+	handlers.SetAlertDefaults(defaultAlertSettings)
+	handlers.SetSessionObserver(func(userID, sessionID int, eventType string, at time.Time) {
+		go publishSupervisorEvent(supervisorEvent{
+			Event:  eventType,
+			UserID: userID,
+			Time:   at,
+			Data:   map[string]interface{}{"session_id": sessionID},
+		})
+	})
+	eyeMetricsConfig = services.EyeMetricsConfig{
+		Window:          time.Duration(cfg.EyeMetricsWindowSec) * time.Second,
+		ClosedThreshold: cfg.EyeClosedThreshold,
+		LongBlink:       time.Duration(cfg.LongBlinkMs) * time.Millisecond,
+	}
+	frameQueueSize = cfg.FrameQueueSize
+	switch cfg.WSSessionAutoEnd {
+	case sessionAutoEndNever, sessionAutoEndStarted, sessionAutoEndAlways:
+	default:
+		log.Fatalf("Invalid WS_SESSION_AUTO_END %q: expected never, started or always", cfg.WSSessionAutoEnd)
+	}
+	sessionAutoEnd = cfg.WSSessionAutoEnd
+	resumeWindow = time.Duration(cfg.WSResumeWindowSec) * time.Second
+	replayBufferSize = cfg.WSReplayBufferSize
+	distractionConfig = services.DistractionConfig{
+		LookAway:      time.Duration(cfg.DistractionLookAwayMs) * time.Millisecond,
+		HeadDown:      time.Duration(cfg.DistractionHeadDownMs) * time.Millisecond,
+		HeadDownAngle: cfg.DistractionHeadDownAngle,
+		Recovery:      time.Duration(cfg.DistractionRecoveryMs) * time.Millisecond,
+	}
+
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -215,6 +357,7 @@ func main() {
 	// Ждём сигнала
 	<-done
 	log.Println("Shutting down...")
+	stopBackground()
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -280,6 +423,7 @@ func startHTTPServer(httpPort string) {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/ws", handleWebSocket)
+	mux.HandleFunc("/ws/supervisor", handleSupervisorWebSocket)
 
 	// mux.HandleFunc("/api/detect", handleDetect)
 	mux.HandleFunc("/api/health", handleHealth)
@@ -299,8 +443,40 @@ func startHTTPServer(httpPort string) {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/api/sessions/current", handlers.GetCurrentSession)
+	mux.HandleFunc("/api/sessions/stream", handlers.StreamSession)
+	mux.HandleFunc("/api/detection-codes", handlers.GetDetectionCodes)
+	mux.HandleFunc("/api/alerts", handlers.GetAlertEpisodes)
+	mux.HandleFunc("/api/alerts/ack-stats", handlers.GetAlertAckStats)
+	mux.HandleFunc("/api/alerts/suppressed", handlers.GetSuppressedAlerts)
+	mux.HandleFunc("/api/suppression-rules", handlers.SuppressionRules)
+	mux.HandleFunc("/api/suppression-rules/delete", handlers.DeleteSuppressionRule)
+	mux.HandleFunc("/api/sessions/state", handlers.SetSessionState)
+	mux.HandleFunc("/api/emergency-contact", handlers.EmergencyContact)
+	mux.HandleFunc("/api/alert-settings", handlers.AlertSettings)
+	mux.HandleFunc("/api/alert-settings/reset", handlers.ResetAlertSettings)
+	mux.HandleFunc("/api/webhooks", handlers.Webhooks)
+	mux.HandleFunc("/api/webhooks/delete", handlers.DeleteWebhook)
+	mux.HandleFunc("/api/webhooks/deliveries", handlers.WebhookDeliveries)
+	mux.HandleFunc("/api/notifications/channels", handlers.NotificationChannels)
+	mux.HandleFunc("/api/notifications/subscriptions", handlers.NotificationSubscriptions)
+	mux.HandleFunc("/api/notifications/subscriptions/delete", handlers.DeleteNotificationSubscription)
+	mux.HandleFunc("/api/notifications/log", handlers.NotificationLog)
+	mux.HandleFunc("/api/shares", handlers.Shares)
+	mux.HandleFunc("/api/shares/revoke", handlers.RevokeShare)
+	mux.HandleFunc("/api/shares/log", handlers.ShareAccessLog)
+	mux.HandleFunc("/api/shared/session", handlers.SharedSession)
+	mux.HandleFunc("/api/shared/events", handlers.SharedEvents)
+	mux.HandleFunc("/api/shared/stream", handlers.SharedStream)
 	mux.HandleFunc("/api/sessions/end", handlers.EndSession)
 	mux.HandleFunc("/api/sessions/delete", handlers.DeleteSession)
+	mux.HandleFunc("/api/sessions/trash", handlers.ListTrash)
+	mux.HandleFunc("/api/sessions/restore", handlers.RestoreSessions)
+	mux.HandleFunc("/api/sessions/export", handlers.ExportSession)
+	mux.HandleFunc("/api/sessions/export/range", handlers.ExportSessionsRange)
+	mux.HandleFunc("/api/sessions/report", handlers.GetSessionReport)
+	mux.HandleFunc("/api/sessions/import", handlers.ImportSessions)
+	mux.HandleFunc("/api/reports/trends", handlers.GetTrends)
 
 	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
@@ -312,6 +488,15 @@ func startHTTPServer(httpPort string) {
 		}
 	})
 
+	mux.HandleFunc("/api/annotations", handlers.Annotations)
+	mux.HandleFunc("/api/annotations/delete", handlers.DeleteAnnotation)
+
+	mux.HandleFunc("/api/admin/archives", handlers.ListArchives)
+	mux.HandleFunc("/api/admin/archives/restore", handlers.RestoreArchive)
+	mux.HandleFunc("/api/admin/retention", handlers.RetentionPolicies)
+	mux.HandleFunc("/api/admin/organizations", handlers.Organizations)
+	mux.HandleFunc("/api/admin/users/role", handlers.SetUserRole)
+
 	log.Println("Database endpoints registered")
 
 	httpServer = &http.Server{
@@ -345,6 +530,7 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		Subprotocols:    []string{wsProtocolBinary, wsProtocolJSON},
 		CheckOrigin: func(r *http.Request) bool {
 			origin := r.Header.Get("Origin")
 			allowed := isOriginAllowed(origin)
@@ -353,47 +539,139 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	// Привязка к сеансу при подключении проверяется до upgrade, чтобы ответить обычным HTTP-статусом
+	var sessionID int
+	if raw := r.URL.Query().Get("session_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid session_id", http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		_, err = services.LoadActiveSession(ctx, database.DB, userID, id)
+		cancel()
+		if err == sql.ErrNoRows {
+			http.Error(w, "Session not found or not active", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Failed to load session %d: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		sessionID = id
+	}
+
+	// Возобновление прежнего подключения: ?clientId= и номер последнего полученного сообщения
+	clientID := r.URL.Query().Get("clientId")
+	var lastSeq uint64
+	resume := false
+	if raw := r.URL.Query().Get("last_seq"); raw != "" && clientID != "" {
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid last_seq", http.StatusBadRequest)
+			return
+		}
+		lastSeq, resume = n, true
+	}
+	// Чужой clientId не принимается: иначе новое подключение вытеснит клиента другого пользователя
+	if clientID != "" && clientIDOwnedByOther(clientID, userID) {
+		http.Error(w, "clientId is in use", http.StatusConflict)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("websocket upgrade failed: %v", err)
 		return
 	}
-	log.Printf("WebSocket upgrade successful")
+	log.Printf("WebSocket upgrade successful (subprotocol %q)", conn.Subprotocol())
+	conn.SetReadLimit(maxClientMessageBytes)
 
-	clientID := r.URL.Query().Get("clientId")
 	if clientID == "" {
 		clientID = generateClientID()
 	}
+	lang := services.DetectionLanguage(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
 
-	log.Printf("WebSocket client connected: %s", clientID)
-
-	// Структура клиента
-	client := &WebSocketClient{
-		conn:     conn,
-		clientID: clientID,
-		send:     make(chan interface{}, 256),
+	var client *WebSocketClient
+	if resume {
+		client = resumableClient(clientID, userID)
 	}
+	resumed := client != nil
+	if resumed {
+		log.Printf("WebSocket client resumed: %s", clientID)
+		// Сеанс из параметра привязывается, только если прежнее подключение не было привязано
+		if _, bound := client.boundSession(); !bound && sessionID != 0 {
+			client.bindSession(sessionID, false)
+		}
+	} else {
+		log.Printf("WebSocket client connected: %s", clientID)
+
+		// Структура клиента
+		client = &WebSocketClient{
+			clientID:    clientID,
+			userID:      userID,
+			send:        make(chan interface{}, 256),
+			eyes:        services.NewEyeMetricsAnalyzer(eyeMetricsConfig),
+			distraction: services.NewDistractionAnalyzer(distractionConfig),
+			suppressed:  make(map[string]int),
+			sessionID:   sessionID,
+			replay:      newReplayBuffer(replayBufferSize),
+		}
+		client.decider, client.alerts = newClientAlerts(userID)
+		client.escalation = newClientEscalation(client)
+	}
+	client.attach(conn, lang)
 
 	// Регистрируем клиента
 	wsClients.mu.Lock()
+	if c, ok := wsClients.clients[clientID]; ok && c.userID != userID {
+		wsClients.mu.Unlock()
+		log.Printf("WebSocket client ID %s taken by another user, closing connection", clientID)
+		conn.Close()
+		if resumed {
+			finishClient(client)
+		}
+		return
+	}
 	wsClients.clients[clientID] = client
 	wsClients.mu.Unlock()
 	atomic.AddInt32(&wsClients.count, 1)
+	driverConnections.Add(1)
+	go publishSupervisorEvent(supervisorEvent{Event: supervisorEventConnected, UserID: userID, ClientID: clientID})
 
 	defer func() {
+		defer driverConnections.Done()
 		// Удаляем клиента при отключении
 		wsClients.mu.Lock()
-		delete(wsClients.clients, clientID)
+		if wsClients.clients[clientID] == client {
+			delete(wsClients.clients, clientID)
+		}
 		wsClients.mu.Unlock()
 		atomic.AddInt32(&wsClients.count, -1)
 
-		conn.Close()
+		client.detach()
 		log.Printf("WebSocket client disconnected: %s", clientID)
+		go publishSupervisorEvent(supervisorEvent{Event: supervisorEventDisconnected, UserID: userID, ClientID: clientID})
+
+		// Тревоги и привязанный сеанс завершаются, только если клиент не переподключится.
+		// При остановке сервера переподключаться некуда
+		if resumeWindow > 0 && !shuttingDown.Load() {
+			detachedClients.park(client)
+		} else {
+			finishClient(client)
+		}
+		close(client.released)
 	}()
 
-	// Запускаем цикл чтения и записи
-	go readPump(client)
+	// Запись и обработка кадров - в отдельных горутинах, чтение - в обработчике до отключения клиента
 	go writePump(client)
+	go client.frames.Run(func(f incomingFrame) { processFrame(client, f) })
+
+	if resumed {
+		resumeDelivery(client, lastSeq)
+		readPump(client)
+		return
+	}
 
 	// Отправляем приветственное сообщение через горутину с задержкой
 	// чтобы убедиться, что writePump запустился
@@ -402,13 +680,18 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		ClientID:  clientID,
 		Timestamp: time.Now().Unix(),
 		Payload: map[string]interface{}{
-			"message": "Connected to Drowsiness Detection Server",
-			"version": "1.0",
+			"message":           "Connected to Drowsiness Detection Server",
+			"version":           "1.0",
+			"protocol":          conn.Subprotocol(),
+			"resume_window_sec": int(resumeWindow.Seconds()),
 		},
 	}
 
 	go func() {
 		time.Sleep(200 * time.Millisecond) // Даем время writePump запуститься
+		if atomic.LoadInt32(&client.closed) != 0 {
+			return
+		}
 		select {
 		case client.send <- welcomeMsg:
 			log.Printf("WELCOME message queued for client %s", clientID)
@@ -417,12 +700,14 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	select {}
+	readPump(client)
 }
 
 // Цикл чтения из WebSocket
 func readPump(client *WebSocketClient) {
 	defer func() {
+		// Ждём обработчик кадров: после него состояние тревог больше никто не меняет
+		client.frames.Close()
 		log.Printf("readPump exiting for client %s", client.clientID)
 	}()
 
@@ -436,8 +721,7 @@ func readPump(client *WebSocketClient) {
 	log.Printf("readPump started for client %s, waiting for messages...", client.clientID)
 
 	for {
-		var msg WebSocketMessage
-		err := client.conn.ReadJSON(&msg)
+		msgType, data, err := client.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error for %s: %v", client.clientID, err)
@@ -449,116 +733,180 @@ func readPump(client *WebSocketClient) {
 			break
 		}
 
+		if msgType == websocket.BinaryMessage {
+			if !client.binary {
+				sendError(client, "Binary frames require subprotocol "+wsProtocolBinary)
+				continue
+			}
+			frame, err := decodeBinaryFrame(data)
+			if err != nil {
+				log.Printf("Invalid binary frame from %s: %v", client.clientID, err)
+				sendError(client, err.Error())
+				continue
+			}
+			client.frames.Push(frame)
+			continue
+		}
+
+		var msg incomingMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("Invalid message from %s: %v", client.clientID, err)
+			sendError(client, "Invalid message format")
+			continue
+		}
+
 		log.Printf("Received from %s: %s", client.clientID, msg.Type)
 
 		switch msg.Type {
 		case "PING":
-			client.send <- WebSocketMessage{
+			trySend(client, WebSocketMessage{
 				Type:      "PONG",
 				ClientID:  client.clientID,
 				Timestamp: time.Now().Unix(),
-			}
+			})
 
 		case "FRAME":
-			payloadBytes, err := json.Marshal(msg.Payload)
+			frame, err := decodeJSONFrame(msg.Payload)
 			if err != nil {
-				log.Printf("Failed to marshal payload: %v", err)
-				client.send <- WebSocketMessage{
-					Type: "ERROR",
-					Payload: map[string]interface{}{
-						"message": "Invalid payload format",
-					},
-				}
+				log.Printf("Invalid frame from %s: %v", client.clientID, err)
+				sendError(client, err.Error())
 				continue
 			}
+			client.frames.Push(frame)
 
-			var frameData models.WSFrameMessage
-			if err := json.Unmarshal(payloadBytes, &frameData); err != nil {
-				log.Printf("Invalid frame data format: %v", err)
-				client.send <- WebSocketMessage{
-					Type: "ERROR",
-					Payload: map[string]interface{}{
-						"message": "Invalid frame data format",
-					},
-				}
-				continue
-			}
+		case "ACK":
+			handleAck(client, msg.Payload)
 
-			frameBytes, err := base64.StdEncoding.DecodeString(frameData.Frame)
-			if err != nil {
-				log.Printf("Base64 decode error: %v", err)
-				client.send <- WebSocketMessage{
-					Type: "ERROR",
-					Payload: map[string]interface{}{
-						"message": "Invalid base64",
-					},
-				}
-				continue
-			}
+		case "SUPPRESS":
+			handleSuppress(client, msg.Payload)
 
-			if len(frameBytes) == 0 {
-				log.Printf("Empty frame data from client %s", client.clientID)
-				continue
-			}
+		case "START_SESSION":
+			handleStartSession(client, msg.Payload)
 
-			videoFrame := &pb.VideoFrame{
-				FrameData:      frameBytes,
-				Timestamp:      frameData.Timestamp,
-				SequenceNumber: frameData.SequenceNumber,
-			}
+		case "JOIN_SESSION":
+			handleJoinSession(client, msg.Payload)
 
-			if grpcClient == nil {
-				client.send <- WebSocketMessage{
-					Type: "ERROR",
-					Payload: map[string]interface{}{
-						"message": "ML service unavailable",
-					},
-				}
-				continue
-			}
+		case "END_SESSION":
+			handleEndSession(client)
 
-			if !grpcClient.HealthCheck() {
-				client.send <- WebSocketMessage{
-					Type: "ERROR",
-					Payload: map[string]interface{}{
-						"message": "ML service disconnected",
-					},
-				}
-				continue
-			}
+		default:
+			log.Printf("Unknown message type: %s", msg.Type)
+		}
+	}
+}
 
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			result, err := grpcClient.ProcessFrame(ctx, videoFrame)
-			cancel()
+// Завершает логическое подключение водителя: открытый эпизод тревоги закрывается (клиенту
+// уже не отправляется), эскалация останавливается, привязанный сеанс завершается по политике
+func finishClient(client *WebSocketClient) {
+	now := time.Now().UTC()
+	if tr := client.alerts.Flush(now); tr != nil {
+		recordAlertTransition(client, tr)
+	}
+	if tr := client.distraction.Flush(now); tr != nil {
+		recordAlertTransition(client, tr)
+	}
+	client.escalation.Stop()
+	autoEndSession(client)
+}
 
-			if err != nil {
-				log.Printf("gRPC error: %v", err)
-				client.send <- WebSocketMessage{
-					Type: "ERROR",
-					Payload: map[string]interface{}{
-						"message": "Processing failed",
-					},
-				}
-				continue
-			}
-			resp := WebSocketMessage{
-				Type:      "DETECTION_RESULT",
-				ClientID:  client.clientID,
-				Timestamp: time.Now().Unix(),
-				Payload: map[string]interface{}{
-					"is_drowsy":        result.IsDrowsy,
-					"drowsiness_score": result.DrowsinessScore,
-					"alert_level":      result.AlertLevel,
-					"inference_time":   result.InferenceTimeMs,
-					"sequence_number":  frameData.SequenceNumber,
-				},
-			}
-			client.send <- resp
+// Отправляет кадр в ML-сервис, отвечает клиенту DETECTION_RESULT и ведёт тревоги.
+// Вызывается только обработчиком очереди кадров клиента
+func processFrame(client *WebSocketClient, in incomingFrame) {
+	if grpcClient == nil {
+		trySend(client, WebSocketMessage{
+			Type: "ERROR",
+			Payload: map[string]interface{}{
+				"message": "ML service unavailable",
+			},
+		})
+		return
+	}
 
-		default:
-			log.Printf("Unknown message type: %s", msg.Type)
+	if !grpcClient.HealthCheck() {
+		trySend(client, WebSocketMessage{
+			Type: "ERROR",
+			Payload: map[string]interface{}{
+				"message": "ML service disconnected",
+			},
+		})
+		return
+	}
+
+	metrics := services.GetMetrics()
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	result, err := grpcClient.ProcessFrame(ctx, in.Frame)
+	cancel()
+
+	if err != nil {
+		metrics.IncrementErrors()
+		log.Printf("gRPC error: %v", err)
+		trySend(client, WebSocketMessage{
+			Type: "ERROR",
+			Payload: map[string]interface{}{
+				"message": "Processing failed",
+			},
+		})
+		return
+	}
+	metrics.RecordLatency(time.Since(start))
+	metrics.IncrementFrames()
+
+	now := time.Now().UTC()
+	smoothed := client.decider.Apply(result, now)
+	eyes := client.eyes.Process(result, now)
+	status := services.DetectionStatusCode(result.Status)
+	level := services.AlertLevelCode(result.Level)
+	payload := map[string]interface{}{
+		"is_drowsy":        result.IsDrowsy,
+		"drowsiness_score": result.DrowsinessScore, // сырая оценка кадра
+		"smoothed_score":   smoothed,
+		"alert_level":      result.AlertLevel,
+		"status":           status,
+		"status_label":     services.DetectionLabel(status, client.lang),
+		"level":            level,
+		"level_label":      services.DetectionLabel(level, client.lang),
+		"inference_time":   result.InferenceTimeMs,
+		"sequence_number":  in.Frame.SequenceNumber,
+		"stream_id":        in.StreamID,
+		"perclos":          eyes.Perclos,
+		"blink_rate":       eyes.BlinkRate,
+		"blinks":           eyes.Blinks,
+		"long_blinks":      eyes.LongBlinks,
+		"dropped_frames":   client.frames.dropped.Load(),
+	}
+	sessionID, bound := client.boundSession()
+	if bound {
+		payload["session_id"] = sessionID
+	}
+	trySend(client, WebSocketMessage{
+		Type:      "DETECTION_RESULT",
+		ClientID:  client.clientID,
+		Timestamp: time.Now().Unix(),
+		Payload:   payload,
+	})
+
+	// Результат кадра сохраняется в привязанный сеанс, как при POST /api/events
+	if bound {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, err := services.SaveDetectionEvent(ctx, database.DB, models.CreateEventRequest{
+			SessionID:       sessionID,
+			DrowsinessScore: float64(result.DrowsinessScore),
+			IsDrowsy:        result.IsDrowsy,
+			Perclos:         &eyes.Perclos,
+			BlinkRate:       &eyes.BlinkRate,
+			LongBlinks:      &eyes.LongBlinks,
+		})
+		cancel()
+		if errors.Is(err, services.ErrSessionNotActive) {
+			releaseInactiveSession(client, sessionID)
+		} else if err != nil {
+			log.Printf("Failed to save event for session %d: %v", sessionID, err)
 		}
 	}
+
+	handleAlertTransition(client, client.alerts.Process(result, now))
+	handleAlertTransition(client, client.distraction.Process(result, now))
 }
 
 func writePump(client *WebSocketClient) {
@@ -566,6 +914,9 @@ func writePump(client *WebSocketClient) {
 	defer func() {
 		log.Printf("writePump exiting for client %s", client.clientID)
 		ticker.Stop()
+		if client.writerDone != nil {
+			close(client.writerDone)
+		}
 	}()
 
 	log.Printf("writePump started for client %s, ready to send messages...", client.clientID)
@@ -595,6 +946,9 @@ func writePump(client *WebSocketClient) {
 				return
 			}
 			log.Printf("Sent PING to client %s", client.clientID)
+
+		case <-client.stop:
+			return
 		}
 	}
 }
@@ -651,15 +1005,29 @@ func handleMetrics(w http.ResponseWriter, r *http.Request) {
 	log.Println("/api/metrics - Metrics request")
 
 	wsClients.mu.RLock()
-	activeClients := len(wsClients.clients)
+	activeClients := 0
+	queues := map[string]interface{}{}
+	for id, c := range wsClients.clients {
+		if c.supervisor == nil {
+			activeClients++
+			queues[id] = map[string]int64{
+				"received":  c.frames.received.Load(),
+				"processed": c.frames.processed.Load(),
+				"dropped":   c.frames.dropped.Load(),
+			}
+		}
+	}
 	wsClients.mu.RUnlock()
 
+	metrics := services.GetMetrics()
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"total_frames":      0,
-		"total_errors":      0,
+		"total_frames":      metrics.GetTotalFrames(),
+		"total_errors":      metrics.GetTotalErrors(),
+		"dropped_frames":    metrics.GetDroppedFrames(),
+		"client_queues":     queues,
 		"active_clients":    activeClients,
-		"avg_latency_ms":    0,
+		"avg_latency_ms":    metrics.GetAvgLatency(),
 		"drowsy_detections": 0,
 		"detection_rate":    0.0,
 		"system_uptime_sec": int(time.Since(serverStartTime).Seconds()),
@@ -667,20 +1035,38 @@ func handleMetrics(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Случайный идентификатор: по нему клиент возобновляет подключение, угадать его не должно быть возможно
 func generateClientID() string {
-	return "client-" + time.Now().Format("20060102150405")
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Failed to generate client ID: %v", err)
+		return "client-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return "client-" + hex.EncodeToString(b)
 }
 
+// Закрывает соединения и дожидается завершения подключений водителей. Канал send не
+// закрывается: в него могут писать обработчик кадров и таймер эскалации, отправку
+// останавливает обработчик подключения
 func closeAllWebSocketConnections() {
-	wsClients.mu.Lock()
-	defer wsClients.mu.Unlock()
+	shuttingDown.Store(true)
 
+	wsClients.mu.Lock()
 	for clientID, client := range wsClients.clients {
-		if atomic.CompareAndSwapInt32(&client.closed, 0, 1) {
-			close(client.send)
-		}
 		client.conn.Close()
 		log.Printf("Closed connection for client: %s", clientID)
 	}
-	wsClients.clients = make(map[string]*WebSocketClient)
+	wsClients.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		driverConnections.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		log.Println("Timed out waiting for WebSocket clients to disconnect")
+	}
+	detachedClients.finishAll()
 }
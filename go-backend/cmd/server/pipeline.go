@@ -0,0 +1,109 @@
+package main
+
+import (
+	"AI_DETECTOR/go-backend/internal/services"
+	"sync"
+	"sync/atomic"
+)
+
+// Очередь кадров клиента: цикл чтения кладёт кадры, не дожидаясь ML-сервиса,
+// а обработчик всегда берёт самый новый кадр. При переполнении вытесняется самый
+// старый кадр, остальные устаревшие кадры отбрасываются при выборке
+type framePipeline struct {
+	mu     sync.Mutex
+	frames []incomingFrame
+	size   int
+	closed bool
+	ready  chan struct{}
+	done   chan struct{}
+
+	received  atomic.Int64
+	processed atomic.Int64
+	dropped   atomic.Int64
+}
+
+func newFramePipeline(size int) *framePipeline {
+	if size < 1 {
+		size = 1
+	}
+	return &framePipeline{
+		frames: make([]incomingFrame, 0, size),
+		size:   size,
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Push ставит кадр в очередь; вызывается из цикла чтения клиента
+func (p *framePipeline) Push(f incomingFrame) {
+	p.received.Add(1)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	if len(p.frames) >= p.size {
+		copy(p.frames, p.frames[1:])
+		p.frames = p.frames[:len(p.frames)-1]
+		p.drop(1)
+	}
+	p.frames = append(p.frames, f)
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (p *framePipeline) drop(n int) {
+	if n > 0 {
+		p.dropped.Add(int64(n))
+		services.GetMetrics().IncrementDroppedFrames(n)
+	}
+}
+
+// Ждёт кадр и возвращает самый новый; false - очередь закрыта
+func (p *framePipeline) next() (incomingFrame, bool) {
+	for {
+		p.mu.Lock()
+		if n := len(p.frames); n > 0 {
+			f := p.frames[n-1]
+			p.drop(n - 1)
+			p.frames = p.frames[:0]
+			p.mu.Unlock()
+			return f, true
+		}
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return incomingFrame{}, false
+		}
+		<-p.ready
+	}
+}
+
+// Run обрабатывает кадры, пока очередь не закрыта
+func (p *framePipeline) Run(process func(incomingFrame)) {
+	defer close(p.done)
+	for {
+		f, ok := p.next()
+		if !ok {
+			return
+		}
+		process(f)
+		p.processed.Add(1)
+	}
+}
+
+// Close закрывает очередь, отбрасывает необработанные кадры и ждёт завершения Run
+func (p *framePipeline) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		p.drop(len(p.frames))
+		p.frames = nil
+		close(p.ready)
+	}
+	p.mu.Unlock()
+	<-p.done
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"AI_DETECTOR/go-backend/internal/services"
+	"AI_DETECTOR/go-backend/pkg/pb"
+	"testing"
+	"time"
+)
+
+func testFrame(seq int32) incomingFrame {
+	return incomingFrame{Frame: &pb.VideoFrame{SequenceNumber: seq}}
+}
+
+func TestFramePipelineDropsOldest(t *testing.T) {
+	const queueSize, pushed = 3, 10
+	metricsBefore := services.GetMetrics().GetDroppedFrames()
+
+	p := newFramePipeline(queueSize)
+	for seq := int32(1); seq <= pushed; seq++ {
+		p.Push(testFrame(seq))
+	}
+
+	seen := make(chan int32, pushed)
+	go p.Run(func(f incomingFrame) { seen <- f.Frame.SequenceNumber })
+
+	select {
+	case seq := <-seen:
+		if seq != pushed {
+			t.Fatalf("worker got frame %d, want newest %d", seq, pushed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker did not receive a frame")
+	}
+	p.Close()
+
+	if got := p.received.Load(); got != pushed {
+		t.Fatalf("received = %d, want %d", got, pushed)
+	}
+	if got := p.processed.Load(); got != 1 {
+		t.Fatalf("processed = %d, want 1", got)
+	}
+	if got := p.dropped.Load(); got != pushed-1 {
+		t.Fatalf("dropped = %d, want %d", got, pushed-1)
+	}
+	if got := services.GetMetrics().GetDroppedFrames() - metricsBefore; got != pushed-1 {
+		t.Fatalf("metrics dropped = %d, want %d", got, pushed-1)
+	}
+}
+
+func TestFramePipelineCloseDropsPending(t *testing.T) {
+	p := newFramePipeline(4)
+	p.Push(testFrame(1))
+	p.Push(testFrame(2))
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	// Обработчик запускается уже после закрытия очереди и кадров не получает
+	for {
+		p.mu.Lock()
+		done := p.closed
+		p.mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	p.Run(func(incomingFrame) { t.Error("frame processed after close") })
+	<-closed
+
+	// Кадры после закрытия учитываются как полученные, но в очередь не попадают
+	p.Push(testFrame(3))
+	if got := p.received.Load(); got != 3 {
+		t.Fatalf("received = %d, want 3", got)
+	}
+	if got := p.dropped.Load(); got != 2 {
+		t.Fatalf("dropped = %d, want 2", got)
+	}
+}
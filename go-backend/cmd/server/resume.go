@@ -0,0 +1,255 @@
+package main
+
+import (
+	"github.com/gorilla/websocket"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Возобновление подключения водителя. После обрыва состояние клиента (тревоги, эскалация,
+// привязанный сеанс) хранится resumeWindow; клиент, переподключившийся с прежним ?clientId=
+// и номером последнего полученного сообщения ?last_seq=, продолжает то же логическое
+// подключение и получает пропущенные результаты и тревоги из буфера повторной отправки
+var (
+	resumeWindow     time.Duration
+	replayBufferSize int
+
+	detachedClients = &detachedRegistry{clients: make(map[string]*WebSocketClient)}
+)
+
+// Сообщения, которые нумеруются и попадают в буфер повторной отправки
+var replayableMessages = map[string]bool{
+	"DETECTION_RESULT": true,
+	"ALERT_START":      true,
+	"ALERT_END":        true,
+	"ALERT_REPEAT":     true,
+	"ALERT_ESCALATED":  true,
+}
+
+// Кольцевой буфер последних нумерованных сообщений клиента. mu также упорядочивает
+// постановку сообщений в очередь отправки с переподключением (см. trySend)
+type replayBuffer struct {
+	mu    sync.Mutex
+	msgs  []WebSocketMessage
+	start int
+	count int
+	seq   uint64
+}
+
+func newReplayBuffer(size int) *replayBuffer {
+	if size < 0 {
+		size = 0
+	}
+	return &replayBuffer{msgs: make([]WebSocketMessage, size)}
+}
+
+// Присваивает сообщению следующий номер и сохраняет его; вызывается под mu
+func (b *replayBuffer) record(msg *WebSocketMessage) {
+	b.seq++
+	msg.Seq = b.seq
+	if len(b.msgs) == 0 {
+		return
+	}
+	if b.count < len(b.msgs) {
+		b.msgs[(b.start+b.count)%len(b.msgs)] = *msg
+		b.count++
+		return
+	}
+	b.msgs[b.start] = *msg
+	b.start = (b.start + 1) % len(b.msgs)
+}
+
+// Сообщения с номером больше last для повторной отправки; вызывается под mu.
+// Если часть пропущенных сообщений уже вытеснена из буфера (или last больше последнего
+// выданного номера), повторять остаток бессмысленно: возвращается resync = true и число
+// потерянных сообщений, и клиент должен заново загрузить состояние
+func (b *replayBuffer) since(last uint64) (msgs []WebSocketMessage, missed uint64, resync bool) {
+	if last > b.seq {
+		return nil, 0, true
+	}
+	if last == b.seq {
+		return nil, 0, false
+	}
+	oldest := b.seq - uint64(b.count) + 1
+	if last+1 < oldest {
+		return nil, oldest - last - 1, true
+	}
+	for i := 0; i < b.count; i++ {
+		msg := b.msgs[(b.start+i)%len(b.msgs)]
+		if msg.Seq > last {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, 0, false
+}
+
+// Отключённые клиенты, ожидающие переподключения
+type detachedRegistry struct {
+	mu      sync.Mutex
+	clients map[string]*WebSocketClient
+}
+
+// Откладывает завершение клиента на resumeWindow. Ожидавший с тем же clientId клиент
+// того же пользователя, вместо которого подключились заново без возобновления, завершается сразу.
+// Клиент другого пользователя не вытесняется: тогда сразу завершается новый
+func (r *detachedRegistry) park(client *WebSocketClient) {
+	r.mu.Lock()
+	prev := r.clients[client.clientID]
+	if prev != nil && prev.userID != client.userID {
+		r.mu.Unlock()
+		log.Printf("Client ID %s is parked for another user, finishing client", client.clientID)
+		finishClient(client)
+		return
+	}
+	r.clients[client.clientID] = client
+	r.mu.Unlock()
+	if prev != nil {
+		go finishClient(prev)
+	}
+
+	time.AfterFunc(resumeWindow, func() {
+		r.mu.Lock()
+		if r.clients[client.clientID] != client {
+			// Клиент уже переподключился
+			r.mu.Unlock()
+			return
+		}
+		delete(r.clients, client.clientID)
+		r.mu.Unlock()
+
+		log.Printf("Resume window expired for client %s", client.clientID)
+		finishClient(client)
+	})
+}
+
+// Завершает всех ожидающих клиентов; вызывается при остановке сервера
+func (r *detachedRegistry) finishAll() {
+	r.mu.Lock()
+	clients := r.clients
+	r.clients = make(map[string]*WebSocketClient)
+	r.mu.Unlock()
+
+	for _, client := range clients {
+		finishClient(client)
+	}
+}
+
+// Забирает отключённого клиента пользователя для возобновления; nil - нечего возобновлять
+func (r *detachedRegistry) take(clientID string, userID int) *WebSocketClient {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	client, ok := r.clients[clientID]
+	if !ok || client.userID != userID {
+		return nil
+	}
+	delete(r.clients, clientID)
+	return client
+}
+
+// clientId занят подключённым или ожидающим переподключения клиентом другого пользователя
+func clientIDOwnedByOther(clientID string, userID int) bool {
+	wsClients.mu.RLock()
+	c, ok := wsClients.clients[clientID]
+	wsClients.mu.RUnlock()
+	if ok && c.userID != userID {
+		return true
+	}
+	detachedClients.mu.Lock()
+	defer detachedClients.mu.Unlock()
+	c, ok = detachedClients.clients[clientID]
+	return ok && c.userID != userID
+}
+
+// Подключённый клиент с тем же clientId: сервер мог ещё не заметить обрыв прежнего соединения
+func attachedClient(clientID string, userID int) *WebSocketClient {
+	wsClients.mu.RLock()
+	defer wsClients.mu.RUnlock()
+	client, ok := wsClients.clients[clientID]
+	if !ok || client.supervisor != nil || client.userID != userID {
+		return nil
+	}
+	return client
+}
+
+// Ищет клиента для возобновления. Прежнее соединение, если оно ещё числится подключённым,
+// закрывается, и клиент дожидается его отключения
+func resumableClient(clientID string, userID int) *WebSocketClient {
+	if old := attachedClient(clientID, userID); old != nil {
+		log.Printf("Client %s reconnected, closing previous connection", clientID)
+		old.conn.Close()
+		select {
+		case <-old.released:
+		case <-time.After(5 * time.Second):
+			log.Printf("Previous connection of client %s was not released in time", clientID)
+			return nil
+		}
+	}
+	return detachedClients.take(clientID, userID)
+}
+
+// Готовит клиента к работе через новое соединение
+func (c *WebSocketClient) attach(conn *websocket.Conn, lang string) {
+	c.conn = conn
+	c.binary = conn.Subprotocol() == wsProtocolBinary
+	c.lang = lang
+	c.frames = newFramePipeline(frameQueueSize)
+	c.stop = make(chan struct{})
+	c.writerDone = make(chan struct{})
+	c.released = make(chan struct{})
+}
+
+// Освобождает соединение клиента: останавливает отправку и отбрасывает неотправленные
+// сообщения - нумерованные из них клиент получит из буфера при переподключении
+func (c *WebSocketClient) detach() {
+	c.replay.mu.Lock()
+	atomic.StoreInt32(&c.closed, 1)
+	c.replay.mu.Unlock()
+
+	close(c.stop)
+	c.conn.Close()
+	<-c.writerDone
+	for {
+		select {
+		case _, ok := <-c.send:
+			if ok {
+				continue
+			}
+		default:
+		}
+		return
+	}
+}
+
+// Ставит в очередь RESUMED и пропущенные клиентом сообщения и возобновляет отправку
+func resumeDelivery(client *WebSocketClient, lastSeq uint64) {
+	client.replay.mu.Lock()
+	defer client.replay.mu.Unlock()
+
+	msgs, missed, resync := client.replay.since(lastSeq)
+	payload := map[string]interface{}{
+		"last_seq": client.replay.seq,
+		"replayed": len(msgs),
+		"missed":   missed,
+		"resync":   resync,
+	}
+	if id, ok := client.boundSession(); ok {
+		payload["session_id"] = id
+	}
+	client.send <- WebSocketMessage{
+		Type:      "RESUMED",
+		ClientID:  client.clientID,
+		Timestamp: time.Now().Unix(),
+		Payload:   payload,
+	}
+	for _, msg := range msgs {
+		select {
+		case client.send <- msg:
+		default:
+			log.Printf("Send buffer full for client %s, dropping replayed %s #%d", client.clientID, msg.Type, msg.Seq)
+		}
+	}
+	atomic.StoreInt32(&client.closed, 0)
+	log.Printf("Client %s resumed from seq %d: %d replayed, %d missed, resync %v", client.clientID, lastSeq, len(msgs), missed, resync)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"AI_DETECTOR/go-backend/internal/services"
+	"slices"
+	"testing"
+	"time"
+)
+
+func filledReplayBuffer(size, messages int) *replayBuffer {
+	b := newReplayBuffer(size)
+	for i := 0; i < messages; i++ {
+		msg := WebSocketMessage{Type: "DETECTION_RESULT"}
+		b.record(&msg)
+	}
+	return b
+}
+
+func messageSeqs(msgs []WebSocketMessage) []uint64 {
+	seqs := []uint64{}
+	for _, m := range msgs {
+		seqs = append(seqs, m.Seq)
+	}
+	return seqs
+}
+
+func TestReplayBufferSince(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		recorded   int
+		last       uint64
+		wantSeqs   []uint64
+		wantMissed uint64
+		wantResync bool
+	}{
+		{name: "nothing recorded", size: 4, recorded: 0, last: 0, wantSeqs: []uint64{}},
+		{name: "up to date", size: 4, recorded: 3, last: 3, wantSeqs: []uint64{}},
+		{name: "replay from seq", size: 4, recorded: 3, last: 1, wantSeqs: []uint64{2, 3}},
+		{name: "replay after eviction", size: 3, recorded: 5, last: 3, wantSeqs: []uint64{4, 5}},
+		{name: "replay whole buffer", size: 3, recorded: 5, last: 2, wantSeqs: []uint64{3, 4, 5}},
+		{name: "seq older than buffer", size: 3, recorded: 5, last: 1, wantSeqs: []uint64{}, wantMissed: 1, wantResync: true},
+		{name: "never received anything", size: 3, recorded: 10, last: 0, wantSeqs: []uint64{}, wantMissed: 7, wantResync: true},
+		{name: "seq ahead of server", size: 3, recorded: 2, last: 5, wantSeqs: []uint64{}, wantResync: true},
+		{name: "no buffer", size: 0, recorded: 2, last: 1, wantSeqs: []uint64{}, wantMissed: 1, wantResync: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := filledReplayBuffer(tt.size, tt.recorded)
+			msgs, missed, resync := b.since(tt.last)
+			if got := messageSeqs(msgs); !slices.Equal(got, tt.wantSeqs) {
+				t.Fatalf("replayed %v, want %v", got, tt.wantSeqs)
+			}
+			if missed != tt.wantMissed || resync != tt.wantResync {
+				t.Fatalf("missed %d resync %v, want %d %v", missed, resync, tt.wantMissed, tt.wantResync)
+			}
+		})
+	}
+}
+
+func testDetachedClient(clientID string, userID int) *WebSocketClient {
+	return &WebSocketClient{
+		clientID:    clientID,
+		userID:      userID,
+		alerts:      services.NewAlertEngine(services.AlertEngineConfig{}),
+		distraction: services.NewDistractionAnalyzer(services.DistractionConfig{}),
+		escalation:  services.NewAlertEscalation(nil, nil),
+		replay:      newReplayBuffer(4),
+	}
+}
+
+func withResumeWindow(t *testing.T, d time.Duration) {
+	prev := resumeWindow
+	resumeWindow = d
+	t.Cleanup(func() { resumeWindow = prev })
+}
+
+func TestDetachedRegistryTake(t *testing.T) {
+	withResumeWindow(t, time.Minute)
+	r := &detachedRegistry{clients: make(map[string]*WebSocketClient)}
+	client := testDetachedClient("client-a", 1)
+	r.park(client)
+
+	if got := r.take("client-a", 2); got != nil {
+		t.Fatal("client of another user was taken")
+	}
+	if got := r.take("client-a", 1); got != client {
+		t.Fatalf("take returned %p, want %p", got, client)
+	}
+	if got := r.take("client-a", 1); got != nil {
+		t.Fatal("client was taken twice")
+	}
+}
+
+func TestDetachedRegistryParkKeepsOtherUsersClient(t *testing.T) {
+	withResumeWindow(t, time.Minute)
+	r := &detachedRegistry{clients: make(map[string]*WebSocketClient)}
+	owner := testDetachedClient("client-a", 1)
+	r.park(owner)
+	r.park(testDetachedClient("client-a", 2))
+
+	if got := r.take("client-a", 1); got != owner {
+		t.Fatal("parked client was replaced by another user's client")
+	}
+}
+
+func TestDetachedRegistryTakeAfterExpiry(t *testing.T) {
+	withResumeWindow(t, 10*time.Millisecond)
+	r := &detachedRegistry{clients: make(map[string]*WebSocketClient)}
+	r.park(testDetachedClient("client-a", 1))
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.Lock()
+		_, parked := r.clients["client-a"]
+		r.mu.Unlock()
+		if !parked {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("parked client did not expire")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := r.take("client-a", 1); got != nil {
+		t.Fatal("expired client was taken")
+	}
+}
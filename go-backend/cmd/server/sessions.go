@@ -0,0 +1,226 @@
+package main
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Завершение привязанного сеанса при закрытии подключения (WS_SESSION_AUTO_END):
+// never - не завершать, started - только сеанс, начатый командой START_SESSION,
+// always - также сеанс, к которому подключение присоединилось
+const (
+	sessionAutoEndNever   = "never"
+	sessionAutoEndStarted = "started"
+	sessionAutoEndAlways  = "always"
+)
+
+var sessionAutoEnd = sessionAutoEndStarted
+
+// Сеанс, к которому привязано подключение: в него сохраняются результаты кадров и тревоги
+func (c *WebSocketClient) boundSession() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID, c.sessionID != 0
+}
+
+func (c *WebSocketClient) bindSession(sessionID int, started bool) {
+	c.mu.Lock()
+	c.sessionID = sessionID
+	c.sessionStarted = started
+	c.mu.Unlock()
+}
+
+// Снимает привязку и возвращает сеанс и признак, что он начат этим подключением
+func (c *WebSocketClient) unbindSession() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, started := c.sessionID, c.sessionStarted
+	c.sessionID, c.sessionStarted = 0, false
+	return id, started
+}
+
+// Снимает привязку, только если подключение всё ещё привязано к sessionID
+func (c *WebSocketClient) unbindSessionIf(sessionID int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessionID != sessionID {
+		return false
+	}
+	c.sessionID, c.sessionStarted = 0, false
+	return true
+}
+
+func sessionMessage(client *WebSocketClient, msgType string, payload interface{}) WebSocketMessage {
+	return WebSocketMessage{
+		Type:      msgType,
+		ClientID:  client.clientID,
+		Timestamp: time.Now().Unix(),
+		Payload:   payload,
+	}
+}
+
+func publishSessionEvent(client *WebSocketClient, event string, sessionID int, at time.Time) {
+	go publishSupervisorEvent(supervisorEvent{
+		Event:    event,
+		UserID:   client.userID,
+		ClientID: client.clientID,
+		Time:     at,
+		Data:     map[string]interface{}{"session_id": sessionID},
+	})
+}
+
+// Начало сеанса: {"type": "START_SESSION", "payload": {"notes": "...", "vehicle_id": "..."}}
+func handleStartSession(client *WebSocketClient, payload json.RawMessage) {
+	var req models.CreateSessionRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			sendError(client, "Invalid START_SESSION payload")
+			return
+		}
+	}
+	if id, ok := client.boundSession(); ok {
+		sendError(client, fmt.Sprintf("Connection is already bound to session %d", id))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := services.StartSession(ctx, database.DB, client.userID, req.Notes, req.VehicleID, appConfig.SingleActiveSession)
+	var activeErr *services.ActiveSessionError
+	if errors.As(err, &activeErr) {
+		trySend(client, sessionMessage(client, "ERROR", map[string]interface{}{
+			"message": "User already has an active session",
+			"session": activeErr.Session,
+		}))
+		return
+	} else if err != nil {
+		log.Printf("Failed to start session for client %s: %v", client.clientID, err)
+		sendError(client, "Failed to start session")
+		return
+	}
+
+	client.bindSession(session.ID, true)
+	log.Printf("Client %s started session %d", client.clientID, session.ID)
+	trySend(client, sessionMessage(client, "SESSION_STARTED", session))
+	publishSessionEvent(client, supervisorEventSessionStart, session.ID, session.StartTime)
+}
+
+// Присоединение к активному сеансу пользователя: {"type": "JOIN_SESSION", "payload": {"session_id": 1}}
+func handleJoinSession(client *WebSocketClient, payload json.RawMessage) {
+	var req struct {
+		SessionID int `json:"session_id"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil || req.SessionID <= 0 {
+		sendError(client, "Invalid JOIN_SESSION payload")
+		return
+	}
+	// Повторное присоединение к тому же сеансу (например, после возобновления) не меняет привязку
+	id, bound := client.boundSession()
+	if bound && id != req.SessionID {
+		sendError(client, fmt.Sprintf("Connection is already bound to session %d", id))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	session, err := services.LoadActiveSession(ctx, database.DB, client.userID, req.SessionID)
+	if err == sql.ErrNoRows {
+		sendError(client, "Session not found or not active")
+		return
+	} else if err != nil {
+		log.Printf("Failed to load session %d for client %s: %v", req.SessionID, client.clientID, err)
+		sendError(client, "Failed to join session")
+		return
+	}
+
+	if !bound {
+		client.bindSession(session.ID, false)
+		log.Printf("Client %s joined session %d", client.clientID, session.ID)
+	}
+	trySend(client, sessionMessage(client, "SESSION_JOINED", session))
+}
+
+// Завершение привязанного сеанса: {"type": "END_SESSION"}
+func handleEndSession(client *WebSocketClient) {
+	sessionID, started := client.unbindSession()
+	if sessionID == 0 {
+		sendError(client, "Connection is not bound to a session")
+		return
+	}
+
+	endTime, err := endBoundSession(client, sessionID)
+	if err == sql.ErrNoRows {
+		sendError(client, "Session not found or not active")
+		return
+	} else if err != nil {
+		// Привязку возвращаем: сеанс по-прежнему активен
+		client.bindSession(sessionID, started)
+		sendError(client, "Failed to end session")
+		return
+	}
+	trySend(client, sessionMessage(client, "SESSION_ENDED", map[string]interface{}{
+		"session_id": sessionID,
+		"end_time":   endTime,
+	}))
+}
+
+// Завершает сеанс, если он ещё активен: сеанс могли завершить через REST, пока подключение
+// было привязано. Уже завершённый сеанс - sql.ErrNoRows
+func endBoundSession(client *WebSocketClient, sessionID int) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	endTime := time.Now().UTC()
+	ended, err := services.EndSession(ctx, database.DB, client.userID, sessionID, endTime)
+	if err != nil {
+		log.Printf("Failed to end session %d for client %s: %v", sessionID, client.clientID, err)
+		return endTime, err
+	}
+	if !ended {
+		return endTime, sql.ErrNoRows
+	}
+	log.Printf("Session %d ended by client %s", sessionID, client.clientID)
+	publishSessionEvent(client, supervisorEventSessionEnd, sessionID, endTime)
+	return endTime, nil
+}
+
+// Сеанс завершили через REST или перенесли в корзину, пока подключение было к нему привязано:
+// снимаем привязку и сообщаем клиенту
+func releaseInactiveSession(client *WebSocketClient, sessionID int) {
+	if !client.unbindSessionIf(sessionID) {
+		return
+	}
+	log.Printf("Session %d is no longer active, client %s unbound", sessionID, client.clientID)
+	trySend(client, sessionMessage(client, "SESSION_ENDED", map[string]interface{}{
+		"session_id": sessionID,
+		"reason":     "session_not_active",
+	}))
+}
+
+// Завершает привязанный сеанс при закрытии подключения согласно WS_SESSION_AUTO_END
+func autoEndSession(client *WebSocketClient) {
+	sessionID, started := client.unbindSession()
+	if sessionID == 0 {
+		return
+	}
+	switch sessionAutoEnd {
+	case sessionAutoEndAlways:
+	case sessionAutoEndStarted:
+		if !started {
+			return
+		}
+	default:
+		return
+	}
+	endBoundSession(client, sessionID)
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/handlers"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// События, которые получают супервизоры
+const (
+	supervisorEventAlertStart      = services.SessionEventAlertStart
+	supervisorEventAlertEnd        = services.SessionEventAlertEnd
+	supervisorEventAlertAck        = "alert_ack"
+	supervisorEventAlertEscalated  = "alert_escalated"
+	supervisorEventAlertSuppressed = "alert_suppressed"
+	supervisorEventSessionStart    = services.SessionEventStarted
+	supervisorEventSessionEnd      = services.SessionEventEnded
+	supervisorEventConnected       = "connected"
+	supervisorEventDisconnected    = "disconnected"
+)
+
+var supervisorEventTypes = map[string]bool{
+	supervisorEventAlertStart:      true,
+	supervisorEventAlertEnd:        true,
+	supervisorEventAlertAck:        true,
+	supervisorEventAlertEscalated:  true,
+	supervisorEventAlertSuppressed: true,
+	supervisorEventSessionStart:    true,
+	supervisorEventSessionEnd:      true,
+	supervisorEventConnected:       true,
+	supervisorEventDisconnected:    true,
+}
+
+var severityRank = map[string]int{
+	models.AlertSeverityLow:    1,
+	models.AlertSeverityMedium: 2,
+	models.AlertSeverityHigh:   3,
+}
+
+// Фильтр подписки супервизора; пустые поля не ограничивают
+type SupervisorFilter struct {
+	Events         []string `json:"events"`
+	UserIDs        []int    `json:"user_ids"`
+	OrganizationID *int     `json:"organization_id"`
+	MinSeverity    string   `json:"min_severity"`
+}
+
+type supervisorFilter struct {
+	events      map[string]bool
+	users       map[int]bool
+	orgID       *int
+	minSeverity int
+}
+
+func compileSupervisorFilter(f SupervisorFilter) (*supervisorFilter, string) {
+	cf := &supervisorFilter{orgID: f.OrganizationID}
+	if len(f.Events) > 0 {
+		cf.events = make(map[string]bool)
+		for _, e := range f.Events {
+			if !supervisorEventTypes[e] {
+				return nil, "Unknown event type: " + e
+			}
+			cf.events[e] = true
+		}
+	}
+	if len(f.UserIDs) > 0 {
+		cf.users = make(map[int]bool)
+		for _, id := range f.UserIDs {
+			cf.users[id] = true
+		}
+	}
+	if f.MinSeverity != "" {
+		rank, ok := severityRank[f.MinSeverity]
+		if !ok {
+			return nil, "Unknown severity: " + f.MinSeverity
+		}
+		cf.minSeverity = rank
+	}
+	return cf, ""
+}
+
+// Фильтр из параметров запроса: ?events=alert_start,alert_end&user_ids=1,2&organization_id=1&min_severity=medium
+func supervisorFilterFromQuery(r *http.Request) (SupervisorFilter, string) {
+	q := r.URL.Query()
+	var f SupervisorFilter
+	if v := q.Get("events"); v != "" {
+		f.Events = strings.Split(v, ",")
+	}
+	if v := q.Get("user_ids"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return f, "Invalid user_ids"
+			}
+			f.UserIDs = append(f.UserIDs, id)
+		}
+	}
+	if v := q.Get("organization_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return f, "Invalid organization_id"
+		}
+		f.OrganizationID = &id
+	}
+	f.MinSeverity = q.Get("min_severity")
+	return f, ""
+}
+
+// Супервизор: кто подписан и что ему разрешено видеть
+type supervisorState struct {
+	userID int
+	role   string
+	orgID  *int
+
+	mu     sync.RWMutex
+	filter *supervisorFilter
+}
+
+// Может ли супервизор видеть водителя: администратор - всех, менеджер - свою организацию
+func (s *supervisorState) canSee(driverID int, driverOrg *int) bool {
+	if driverID == s.userID || s.role == models.RoleAdmin {
+		return true
+	}
+	return s.role == models.RoleManager && s.orgID != nil && driverOrg != nil && *s.orgID == *driverOrg
+}
+
+func (s *supervisorState) accepts(evt supervisorEvent, driverOrg *int) bool {
+	if !s.canSee(evt.UserID, driverOrg) {
+		return false
+	}
+	s.mu.RLock()
+	f := s.filter
+	s.mu.RUnlock()
+
+	if f.events != nil && !f.events[evt.Event] {
+		return false
+	}
+	if f.users != nil && !f.users[evt.UserID] {
+		return false
+	}
+	if f.orgID != nil && (driverOrg == nil || *driverOrg != *f.orgID) {
+		return false
+	}
+	if f.minSeverity > 0 && evt.Severity != "" && severityRank[evt.Severity] < f.minSeverity {
+		return false
+	}
+	return true
+}
+
+type supervisorEvent struct {
+	Event    string      `json:"event"`
+	UserID   int         `json:"user_id"`
+	Username string      `json:"username,omitempty"`
+	ClientID string      `json:"client_id,omitempty"`
+	Severity string      `json:"severity,omitempty"`
+	Time     time.Time   `json:"time"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+func loadUserScope(ctx context.Context, userID int) (role, username string, orgID *int, err error) {
+	var org sql.NullInt64
+	err = database.DB.QueryRowContext(ctx,
+		"SELECT role, username, organization_id FROM users WHERE id = $1", userID,
+	).Scan(&role, &username, &org)
+	if org.Valid {
+		id := int(org.Int64)
+		orgID = &id
+	}
+	return
+}
+
+func hasSupervisors() bool {
+	wsClients.mu.RLock()
+	defer wsClients.mu.RUnlock()
+	for _, c := range wsClients.clients {
+		if c.supervisor != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Рассылает событие водителя всем подключённым супервизорам, которым оно разрешено и подходит по фильтру.
+// Медленный супервизор пропускает событие, а не задерживает рассылку
+func publishSupervisorEvent(evt supervisorEvent) {
+	if !hasSupervisors() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	_, username, driverOrg, err := loadUserScope(ctx, evt.UserID)
+	cancel()
+	if err != nil {
+		log.Printf("Supervisor hub: failed to load user %d: %v", evt.UserID, err)
+		return
+	}
+	evt.Username = username
+	if evt.Time.IsZero() {
+		evt.Time = time.Now().UTC()
+	}
+
+	msg := WebSocketMessage{
+		Type:      "SUPERVISOR_EVENT",
+		Timestamp: time.Now().Unix(),
+		Payload:   evt,
+	}
+
+	wsClients.mu.RLock()
+	defer wsClients.mu.RUnlock()
+	for _, c := range wsClients.clients {
+		if c.supervisor == nil || atomic.LoadInt32(&c.closed) != 0 || !c.supervisor.accepts(evt, driverOrg) {
+			continue
+		}
+		select {
+		case c.send <- msg:
+		default:
+			log.Printf("Supervisor hub: send buffer full for %s, dropping %s", c.clientID, evt.Event)
+		}
+	}
+}
+
+// Подключённые водители, которых видит супервизор, для начального снимка
+func supervisorSnapshot(ctx context.Context, s *supervisorState) []supervisorEvent {
+	type driverConn struct {
+		userID   int
+		clientID string
+	}
+	var drivers []driverConn
+	wsClients.mu.RLock()
+	for _, c := range wsClients.clients {
+		if c.supervisor == nil {
+			drivers = append(drivers, driverConn{userID: c.userID, clientID: c.clientID})
+		}
+	}
+	wsClients.mu.RUnlock()
+
+	snapshot := []supervisorEvent{}
+	for _, d := range drivers {
+		_, username, org, err := loadUserScope(ctx, d.userID)
+		if err != nil {
+			continue
+		}
+		evt := supervisorEvent{Event: supervisorEventConnected, UserID: d.userID, Username: username, ClientID: d.clientID}
+		if s.accepts(evt, org) {
+			snapshot = append(snapshot, evt)
+		}
+	}
+	return snapshot
+}
+
+// Подписка супервизора (менеджера или администратора) на события водителей в реальном времени.
+// GET /ws/supervisor[?events=...&user_ids=...&organization_id=...&min_severity=...]
+// Фильтр можно заменить сообщением {"type": "SUBSCRIBE", "payload": {...}}
+func handleSupervisorWebSocket(w http.ResponseWriter, r *http.Request) {
+	userID, exists := handlers.GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	role, _, orgID, err := loadUserScope(ctx, userID)
+	cancel()
+	if err != nil {
+		log.Printf("Supervisor: failed to load user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if role != models.RoleManager && role != models.RoleAdmin {
+		http.Error(w, "Forbidden: manager or admin role required", http.StatusForbidden)
+		return
+	}
+
+	raw, msg := supervisorFilterFromQuery(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	filter, msg := compileSupervisorFilter(raw)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			return isOriginAllowed(r.Header.Get("Origin"))
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("supervisor websocket upgrade failed: %v", err)
+		return
+	}
+
+	state := &supervisorState{userID: userID, role: role, orgID: orgID, filter: filter}
+	client := &WebSocketClient{
+		conn:       conn,
+		clientID:   "supervisor-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		userID:     userID,
+		send:       make(chan interface{}, 256),
+		supervisor: state,
+	}
+
+	wsClients.mu.Lock()
+	wsClients.clients[client.clientID] = client
+	wsClients.mu.Unlock()
+	log.Printf("Supervisor connected: %s (user %d, %s)", client.clientID, userID, role)
+
+	defer func() {
+		wsClients.mu.Lock()
+		delete(wsClients.clients, client.clientID)
+		if atomic.CompareAndSwapInt32(&client.closed, 0, 1) {
+			close(client.send)
+		}
+		wsClients.mu.Unlock()
+		conn.Close()
+		log.Printf("Supervisor disconnected: %s", client.clientID)
+	}()
+
+	go writePump(client)
+
+	snapCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	client.send <- WebSocketMessage{
+		Type:      "SUPERVISOR_SNAPSHOT",
+		ClientID:  client.clientID,
+		Timestamp: time.Now().Unix(),
+		Payload:   map[string]interface{}{"connected": supervisorSnapshot(snapCtx, state)},
+	}
+	cancel()
+
+	supervisorReadPump(client)
+}
+
+func supervisorReadPump(client *WebSocketClient) {
+	client.conn.SetReadDeadline(time.Now().Add(70 * time.Second))
+	client.conn.SetPongHandler(func(string) error {
+		client.conn.SetReadDeadline(time.Now().Add(70 * time.Second))
+		return nil
+	})
+
+	for {
+		var msg incomingMessage
+		if err := client.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Supervisor %s read error: %v", client.clientID, err)
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "PING":
+			trySend(client, WebSocketMessage{
+				Type:      "PONG",
+				ClientID:  client.clientID,
+				Timestamp: time.Now().Unix(),
+			})
+
+		case "SUBSCRIBE":
+			var raw SupervisorFilter
+			if err := json.Unmarshal(msg.Payload, &raw); err != nil {
+				sendError(client, "Invalid filter format")
+				continue
+			}
+			filter, errMsg := compileSupervisorFilter(raw)
+			if errMsg != "" {
+				sendError(client, errMsg)
+				continue
+			}
+			client.supervisor.mu.Lock()
+			client.supervisor.filter = filter
+			client.supervisor.mu.Unlock()
+			trySend(client, WebSocketMessage{
+				Type:      "SUBSCRIBED",
+				ClientID:  client.clientID,
+				Timestamp: time.Now().Unix(),
+				Payload:   raw,
+			})
+
+		default:
+			sendError(client, "Unsupported message type for supervisor: "+msg.Type)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+)
+
+// Наибольшая длительность подавления по команде SUPPRESS
+const maxSuppressMinutes = 240
+
+var suppressionStore *services.SuppressionStore
+
+// Проверяет правила подавления при начале тревоги и ведёт подавленный эпизод до его окончания.
+// Возвращает true, если переход подавлен и обычная обработка не нужна.
+// При ошибке проверки тревога не подавляется
+func suppressAlertTransition(ctx context.Context, client *WebSocketClient, tr *services.AlertTransition) bool {
+	ep := tr.Episode
+
+	if tr.Type != services.AlertStarted {
+		id, ok := client.suppressed[ep.AlertType]
+		if !ok {
+			return false
+		}
+		delete(client.suppressed, ep.AlertType)
+		if id != 0 {
+			if err := suppressionStore.CloseSuppressed(ctx, id, ep); err != nil {
+				log.Printf("Failed to close suppressed alert %d: %v", id, err)
+			}
+		}
+		return true
+	}
+
+	var sessionID *int
+	if id, ok := client.boundSession(); ok {
+		sessionID = &id
+	}
+	match, err := suppressionStore.Match(ctx, client.userID, sessionID, ep.StartTime)
+	if err != nil {
+		log.Printf("Failed to check suppression rules for client %s: %v", client.clientID, err)
+		return false
+	}
+	if match == nil {
+		return false
+	}
+
+	ep.UserID = client.userID
+	ep.ClientID = client.clientID
+	ep.SessionID = match.SessionID
+	id, err := suppressionStore.RecordSuppressed(ctx, ep, match)
+	if err != nil {
+		log.Printf("Failed to save suppressed alert for client %s: %v", client.clientID, err)
+	}
+	client.suppressed[ep.AlertType] = id
+	log.Printf("%s alert for client %s suppressed by rule %d (%s)", ep.AlertType, client.clientID, match.Rule.ID, match.Rule.Kind)
+
+	go publishSupervisorEvent(supervisorEvent{
+		Event:    supervisorEventAlertSuppressed,
+		UserID:   client.userID,
+		ClientID: client.clientID,
+		Severity: ep.Severity,
+		Data: map[string]interface{}{
+			"alert_type": ep.AlertType,
+			"rule_id":    match.Rule.ID,
+			"kind":       match.Rule.Kind,
+			"reason":     match.Rule.Reason,
+			"start_time": ep.StartTime,
+		},
+	})
+	return true
+}
+
+// Подавление тревог по команде водителя: {"type": "SUPPRESS", "payload": {"minutes": 10, "reason": "parking"}}.
+// minutes = 0 отменяет действующие окна, созданные командой
+func handleSuppress(client *WebSocketClient, payload json.RawMessage) {
+	var req struct {
+		Minutes int    `json:"minutes"`
+		Reason  string `json:"reason"`
+	}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			sendError(client, "Invalid SUPPRESS payload")
+			return
+		}
+	}
+	if req.Minutes < 0 || req.Minutes > maxSuppressMinutes {
+		sendError(client, "minutes must be between 0 and 240")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if req.Minutes == 0 {
+		n, err := suppressionStore.CancelCommandSuppression(ctx, client.userID)
+		if err != nil {
+			log.Printf("Failed to cancel suppression for client %s: %v", client.clientID, err)
+			sendError(client, "Failed to cancel suppression")
+			return
+		}
+		trySend(client, WebSocketMessage{
+			Type:      "SUPPRESSED",
+			ClientID:  client.clientID,
+			Timestamp: time.Now().Unix(),
+			Payload:   map[string]interface{}{"cancelled": n},
+		})
+		return
+	}
+
+	rule, err := suppressionStore.SuppressFor(ctx, client.userID,
+		time.Duration(req.Minutes)*time.Minute, strings.TrimSpace(req.Reason))
+	if err != nil {
+		log.Printf("Failed to create suppression for client %s: %v", client.clientID, err)
+		sendError(client, "Failed to suppress alerts")
+		return
+	}
+	log.Printf("Alerts of client %s suppressed for %d min (rule %d)", client.clientID, req.Minutes, rule.ID)
+
+	trySend(client, WebSocketMessage{
+		Type:      "SUPPRESSED",
+		ClientID:  client.clientID,
+		Timestamp: time.Now().Unix(),
+		Payload:   rule,
+	})
+}
@@ -27,6 +27,65 @@ type Config struct {
 	DBUser     string
 	DBPassword string
 	DBSSLMode  string
+
+	RetentionDays          int
+	RetentionCheckInterval int
+	ArchiveDir             string
+
+	SessionPurgeAfterDays int
+	SessionPurgeInterval  int
+
+	SingleActiveSession bool
+
+	ShareSecret string
+
+	AlertScoreThreshold float64
+	AlertHysteresis     float64
+	AlertMinDurationMs  int
+	AlertCooldownSec    int
+	// Сглаживание покадровой оценки по умолчанию: none, ema или median
+	ScoreSmoothing       string
+	ScoreSmoothingAlpha  float64
+	ScoreSmoothingWindow int
+	// Цепочка эскалации неподтверждённой тревоги: "repeat:15s,manager:45s,emergency:2m"
+	EscalationChain string
+
+	// Размер очереди кадров WebSocket-клиента; при переполнении отбрасываются старые кадры
+	FrameQueueSize int
+	// Завершение сеанса, привязанного к WebSocket, при отключении: never, started или always
+	WSSessionAutoEnd string
+	// Сколько ждать переподключения отключившегося клиента и сколько последних результатов
+	// и тревог хранить для повторной отправки; 0 секунд - без возобновления
+	WSResumeWindowSec  int
+	WSReplayBufferSize int
+
+	EyeMetricsWindowSec int
+	EyeClosedThreshold  float64
+	LongBlinkMs         int
+
+	// Отвлечение: взгляд в сторону дольше DistractionLookAwayMs или голова опущена
+	// на DistractionHeadDownAngle градусов дольше DistractionHeadDownMs
+	DistractionLookAwayMs    int
+	DistractionHeadDownMs    int
+	DistractionHeadDownAngle float64
+	DistractionRecoveryMs    int
+
+	WebhookPollIntervalSec int
+	WebhookTimeoutSec      int
+	WebhookMaxAttempts     int
+	// Разрешить webhook на loopback, частные и link-local адреса
+	WebhookAllowPrivateTargets bool
+
+	NotificationTimeoutSec int
+	NotificationSecret     string
+	NotificationWorkers    int
+	SMTPHost               string
+	SMTPPort               int
+	SMTPUsername           string
+	SMTPPassword           string
+	SMTPFrom               string
+	ChatBotAPIURL          string
+	ChatBotToken           string
 }
 
 func (p *Config) DSN() string {
@@ -65,6 +124,56 @@ func LoadConfig() *Config {
 		DBPassword:       getEnv("DB_PASSWORD", ""),
 		DBName:           getEnv("DB_NAME", "ai_detector"),
 		DBSSLMode:        getEnv("DB_SSLMODE", "disable"),
+
+		RetentionDays:          getEnvInt("RETENTION_DAYS", 0),
+		RetentionCheckInterval: getEnvInt("RETENTION_CHECK_INTERVAL_MIN", 60),
+		ArchiveDir:             getEnv("ARCHIVE_DIR", "archives"),
+
+		SessionPurgeAfterDays: getEnvInt("SESSION_PURGE_AFTER_DAYS", 30),
+		SessionPurgeInterval:  getEnvInt("SESSION_PURGE_INTERVAL_MIN", 60),
+
+		SingleActiveSession: getEnvBool("SINGLE_ACTIVE_SESSION", false),
+
+		ShareSecret: getEnv("SHARE_SECRET", ""),
+
+		AlertScoreThreshold:  getEnvFloat("ALERT_SCORE_THRESHOLD", 0.5),
+		AlertHysteresis:      getEnvFloat("ALERT_HYSTERESIS", 0.1),
+		AlertMinDurationMs:   getEnvInt("ALERT_MIN_DURATION_MS", 0),
+		AlertCooldownSec:     getEnvInt("ALERT_COOLDOWN_SEC", 0),
+		ScoreSmoothing:       getEnv("SCORE_SMOOTHING", "ema"),
+		ScoreSmoothingAlpha:  getEnvFloat("SCORE_SMOOTHING_ALPHA", 0.3),
+		ScoreSmoothingWindow: getEnvInt("SCORE_SMOOTHING_WINDOW", 5),
+		EscalationChain:      getEnv("ESCALATION_CHAIN", "repeat:15s,manager:45s,emergency:2m"),
+
+		FrameQueueSize:     getEnvInt("FRAME_QUEUE_SIZE", 2),
+		WSSessionAutoEnd:   getEnv("WS_SESSION_AUTO_END", "started"),
+		WSResumeWindowSec:  getEnvInt("WS_RESUME_WINDOW_SEC", 30),
+		WSReplayBufferSize: getEnvInt("WS_REPLAY_BUFFER_SIZE", 100),
+
+		EyeMetricsWindowSec: getEnvInt("EYE_METRICS_WINDOW_SEC", 60),
+		EyeClosedThreshold:  getEnvFloat("EYE_CLOSED_THRESHOLD", 0.5),
+		LongBlinkMs:         getEnvInt("LONG_BLINK_MS", 500),
+
+		DistractionLookAwayMs:    getEnvInt("DISTRACTION_LOOK_AWAY_MS", 2000),
+		DistractionHeadDownMs:    getEnvInt("DISTRACTION_HEAD_DOWN_MS", 3000),
+		DistractionHeadDownAngle: getEnvFloat("DISTRACTION_HEAD_DOWN_ANGLE", 20),
+		DistractionRecoveryMs:    getEnvInt("DISTRACTION_RECOVERY_MS", 1000),
+
+		WebhookPollIntervalSec:     getEnvInt("WEBHOOK_POLL_INTERVAL_SEC", 5),
+		WebhookTimeoutSec:          getEnvInt("WEBHOOK_TIMEOUT_SEC", 10),
+		WebhookMaxAttempts:         getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookAllowPrivateTargets: getEnvBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", false),
+
+		NotificationTimeoutSec: getEnvInt("NOTIFICATION_TIMEOUT_SEC", 10),
+		NotificationSecret:     getEnv("NOTIFICATION_WEBHOOK_SECRET", ""),
+		NotificationWorkers:    getEnvInt("NOTIFICATION_WORKERS", 4),
+		SMTPHost:               getEnv("SMTP_HOST", ""),
+		SMTPPort:               getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:           getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:           getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:               getEnv("SMTP_FROM", ""),
+		ChatBotAPIURL:          getEnv("CHATBOT_API_URL", "https://api.telegram.org"),
+		ChatBotToken:           getEnv("CHATBOT_TOKEN", ""),
 	}
 
 	// Проверка обязательных полей
@@ -94,3 +203,21 @@ func getEnvInt(key string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+func getEnvBool(key string, defaultVal bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if boolVal, err := strconv.ParseBool(v); err == nil {
+			return boolVal
+		}
+	}
+	return defaultVal
+}
+
+func getEnvFloat(key string, defaultVal float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if floatVal, err := strconv.ParseFloat(v, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultVal
+}
@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func getUserRole(ctx context.Context, userID int) (string, error) {
+	var role string
+	err := database.DB.QueryRowContext(ctx, "SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	return role, err
+}
+
+// Проверяет, может ли viewer видеть данные пользователя owner: свои данные видны всегда,
+// администратору - данные всех, руководителю - водителей своей организации
+func canViewUser(ctx context.Context, viewerID, ownerID int) (bool, error) {
+	if viewerID == ownerID {
+		return true, nil
+	}
+
+	var role string
+	var viewerOrg, ownerOrg sql.NullInt64
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT v.role, v.organization_id, o.organization_id FROM users v, users o WHERE v.id = $1 AND o.id = $2",
+		viewerID, ownerID,
+	).Scan(&role, &viewerOrg, &ownerOrg)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	switch role {
+	case models.RoleAdmin:
+		return true, nil
+	case models.RoleManager:
+		return viewerOrg.Valid && ownerOrg.Valid && viewerOrg.Int64 == ownerOrg.Int64, nil
+	}
+	return false, nil
+}
+
+// Проверяет, может ли actor менять настройки пользователя target: администратор - любого,
+// руководитель - пользователей своей организации (включая себя). Водитель свои не меняет
+func canManageUser(ctx context.Context, actorID, targetID int) (bool, error) {
+	var role string
+	var actorOrg, targetOrg sql.NullInt64
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT a.role, a.organization_id, t.organization_id FROM users a, users t WHERE a.id = $1 AND t.id = $2",
+		actorID, targetID,
+	).Scan(&role, &actorOrg, &targetOrg)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	switch role {
+	case models.RoleAdmin:
+		return true, nil
+	case models.RoleManager:
+		return actorID == targetID || (actorOrg.Valid && targetOrg.Valid && actorOrg.Int64 == targetOrg.Int64), nil
+	}
+	return false, nil
+}
+
+// Проверяет, может ли actor менять настройки организации: администратор или её руководитель
+func canManageOrganization(ctx context.Context, actorID, orgID int) (bool, error) {
+	var role string
+	var actorOrg sql.NullInt64
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT role, organization_id FROM users WHERE id = $1", actorID,
+	).Scan(&role, &actorOrg)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	switch role {
+	case models.RoleAdmin:
+		return true, nil
+	case models.RoleManager:
+		return actorOrg.Valid && int(actorOrg.Int64) == orgID, nil
+	}
+	return false, nil
+}
+
+// Определяет пользователя из параметра user_id (по умолчанию - сам viewer)
+// и проверяет доступ к его данным. При отказе сам пишет ответ клиенту
+func resolveTargetUser(ctx context.Context, w http.ResponseWriter, r *http.Request, viewerID int) (int, bool) {
+	v := r.URL.Query().Get("user_id")
+	if v == "" {
+		return viewerID, true
+	}
+	userID, err := strconv.Atoi(v)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	allowed, err := canViewUser(ctx, viewerID, userID)
+	if err != nil {
+		log.Printf("Failed to check user access: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if !allowed {
+		http.Error(w, "Forbidden: no access to this user", http.StatusForbidden)
+		return 0, false
+	}
+	return userID, true
+}
+
+// Проверяет авторизацию и роль администратора.
+// При отказе сам пишет ответ клиенту
+func requireAdmin(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	role, err := getUserRole(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user role: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if role != models.RoleAdmin {
+		http.Error(w, "Forbidden: admin role required", http.StatusForbidden)
+		return 0, false
+	}
+	return userID, true
+}
+
+// ListArchives возвращает архивы событий, созданные заданием хранения.
+// GET /api/admin/archives
+func ListArchives(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	rows, err := database.DB.QueryContext(r.Context(),
+		`SELECT id, user_id, file_path, cutoff, sessions_count, events_count, size_bytes, status, created_at, restored_at
+		FROM event_archives ORDER BY created_at DESC`,
+	)
+	if err != nil {
+		log.Printf("Failed to fetch archives: %v", err)
+		http.Error(w, "Failed to fetch archives", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	archives := []models.EventArchive{}
+	for rows.Next() {
+		var a models.EventArchive
+		var userID sql.NullInt64
+		var restoredAt sql.NullTime
+		if err := rows.Scan(&a.ID, &userID, &a.FilePath, &a.Cutoff, &a.SessionsCount, &a.EventsCount,
+			&a.SizeBytes, &a.Status, &a.CreatedAt, &restoredAt); err != nil {
+			continue
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			a.UserID = &id
+		}
+		if restoredAt.Valid {
+			a.RestoredAt = &restoredAt.Time
+		}
+		archives = append(archives, a)
+	}
+
+	json.NewEncoder(w).Encode(archives)
+}
+
+// RestoreArchive загружает архив событий обратно в базу.
+// POST /api/admin/archives/restore?id=1
+func RestoreArchive(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	archiveID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid archive ID", http.StatusBadRequest)
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	report, err := services.RestoreArchive(r.Context(), database.DB, archiveID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Archive not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Failed to restore archive %d: %v", archiveID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  err.Error(),
+			"report": report,
+		})
+		return
+	}
+
+	log.Printf("Archive %d restored by admin %d: %d events", archiveID, adminID, report.EventsRestored)
+	json.NewEncoder(w).Encode(report)
+}
+
+// RetentionPolicies: GET - список политик хранения, POST - создать или изменить
+// политику пользователя или организации. retention_days = 0 отключает удаление.
+// /api/admin/retention
+func RetentionPolicies(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := database.DB.QueryContext(r.Context(),
+			"SELECT id, organization_id, user_id, retention_days, updated_at FROM retention_policies ORDER BY id",
+		)
+		if err != nil {
+			log.Printf("Failed to fetch retention policies: %v", err)
+			http.Error(w, "Failed to fetch retention policies", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		policies := []models.RetentionPolicy{}
+		for rows.Next() {
+			var p models.RetentionPolicy
+			var orgID, userID sql.NullInt64
+			if err := rows.Scan(&p.ID, &orgID, &userID, &p.RetentionDays, &p.UpdatedAt); err != nil {
+				continue
+			}
+			if orgID.Valid {
+				id := int(orgID.Int64)
+				p.OrganizationID = &id
+			}
+			if userID.Valid {
+				id := int(userID.Int64)
+				p.UserID = &id
+			}
+			policies = append(policies, p)
+		}
+		json.NewEncoder(w).Encode(policies)
+
+	case http.MethodPost:
+		var req models.RetentionPolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if (req.OrganizationID == nil) == (req.UserID == nil) {
+			http.Error(w, "Exactly one of organization_id or user_id is required", http.StatusBadRequest)
+			return
+		}
+		if req.RetentionDays < 0 {
+			http.Error(w, "retention_days must be non-negative", http.StatusBadRequest)
+			return
+		}
+
+		conflict := "user_id"
+		if req.OrganizationID != nil {
+			conflict = "organization_id"
+		}
+		_, err := database.DB.ExecContext(r.Context(),
+			`INSERT INTO retention_policies (organization_id, user_id, retention_days, updated_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (`+conflict+`) DO UPDATE SET retention_days = EXCLUDED.retention_days, updated_at = EXCLUDED.updated_at`,
+			req.OrganizationID, req.UserID, req.RetentionDays, time.Now().UTC(),
+		)
+		if err != nil {
+			log.Printf("Failed to save retention policy: %v", err)
+			http.Error(w, "Failed to save retention policy", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Retention policy saved"))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Organizations: GET - список организаций, POST - создать организацию.
+// /api/admin/organizations
+func Organizations(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := database.DB.QueryContext(r.Context(),
+			"SELECT id, name, created_at FROM organizations ORDER BY id",
+		)
+		if err != nil {
+			log.Printf("Failed to fetch organizations: %v", err)
+			http.Error(w, "Failed to fetch organizations", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		orgs := []models.Organization{}
+		for rows.Next() {
+			var o models.Organization
+			if err := rows.Scan(&o.ID, &o.Name, &o.CreatedAt); err != nil {
+				continue
+			}
+			orgs = append(orgs, o)
+		}
+		json.NewEncoder(w).Encode(orgs)
+
+	case http.MethodPost:
+		var req models.CreateOrganizationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+
+		o := models.Organization{Name: req.Name, CreatedAt: time.Now().UTC()}
+		err := database.DB.QueryRowContext(r.Context(),
+			"INSERT INTO organizations (name, created_at) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING RETURNING id",
+			o.Name, o.CreatedAt,
+		).Scan(&o.ID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Organization already exists", http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Printf("Failed to create organization: %v", err)
+			http.Error(w, "Failed to create organization", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Organization %d created by admin %d", o.ID, adminID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(o)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SetUserRole назначает пользователю роль и организацию.
+// POST /api/admin/users/role с телом {"user_id": 1, "role": "manager", "organization_id": 2}
+func SetUserRole(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminID, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	switch req.Role {
+	case models.RoleDriver, models.RoleManager, models.RoleAdmin:
+	default:
+		http.Error(w, "role must be driver, manager or admin", http.StatusBadRequest)
+		return
+	}
+	// Руководитель без организации никого не видит
+	if req.Role == models.RoleManager && req.OrganizationID == nil {
+		http.Error(w, "organization_id is required for managers", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if req.OrganizationID != nil {
+		var exists bool
+		err := database.DB.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM organizations WHERE id = $1)", *req.OrganizationID,
+		).Scan(&exists)
+		if err != nil {
+			log.Printf("Failed to check organization: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "Organization not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := database.DB.ExecContext(ctx,
+		"UPDATE users SET role = $1, organization_id = $2 WHERE id = $3",
+		req.Role, req.OrganizationID, req.UserID,
+	)
+	if err != nil {
+		log.Printf("Failed to update user role: %v", err)
+		http.Error(w, "Failed to update user role", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("User %d set to role %s by admin %d", req.UserID, req.Role, adminID)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("User role saved"))
+}
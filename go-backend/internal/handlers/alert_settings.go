@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Настройки тревоги по умолчанию, задаются из конфигурации при запуске
+var alertDefaults = models.AlertSettings{ScoreThreshold: 0.5}
+
+func SetAlertDefaults(settings models.AlertSettings) {
+	alertDefaults = settings
+}
+
+func validateAlertSettings(req models.AlertSettingsRequest) string {
+	if (req.OrganizationID == nil) == (req.UserID == nil) {
+		return "Exactly one of organization_id or user_id is required"
+	}
+	if req.ScoreThreshold <= 0 || req.ScoreThreshold > 1 {
+		return "score_threshold must be in (0, 1]"
+	}
+	if req.MinDurationMs < 0 || req.MinDurationMs > 60000 {
+		return "min_duration_ms must be between 0 and 60000"
+	}
+	if req.CooldownSec < 0 || req.CooldownSec > 3600 {
+		return "cooldown_sec must be between 0 and 3600"
+	}
+	switch req.SmoothingMethod {
+	case models.SmoothingNone, models.SmoothingEMA, models.SmoothingMedian:
+	default:
+		return "smoothing_method must be one of none, ema, median"
+	}
+	if req.SmoothingAlpha <= 0 || req.SmoothingAlpha > 1 {
+		return "smoothing_alpha must be in (0, 1]"
+	}
+	if req.SmoothingWindow < 1 || req.SmoothingWindow > 100 {
+		return "smoothing_window must be between 1 and 100"
+	}
+	if *req.Hysteresis < 0 || *req.Hysteresis >= req.ScoreThreshold {
+		return "hysteresis must be in [0, score_threshold)"
+	}
+	return ""
+}
+
+// Подставляет параметры сглаживания по умолчанию вместо не заданных в запросе
+func applySmoothingDefaults(req *models.AlertSettingsRequest) {
+	if req.SmoothingMethod == "" {
+		req.SmoothingMethod = alertDefaults.SmoothingMethod
+	}
+	if req.SmoothingAlpha == 0 {
+		req.SmoothingAlpha = alertDefaults.SmoothingAlpha
+	}
+	if req.SmoothingWindow == 0 {
+		req.SmoothingWindow = alertDefaults.SmoothingWindow
+	}
+	if req.Hysteresis == nil {
+		h := min(alertDefaults.Hysteresis, req.ScoreThreshold/2)
+		req.Hysteresis = &h
+	}
+}
+
+// Проверяет право менять настройки пользователя или организации.
+// При отказе сам пишет ответ клиенту
+func authorizeAlertSettingsChange(ctx context.Context, w http.ResponseWriter, actorID int, orgID, userID *int) bool {
+	var allowed bool
+	var err error
+	if orgID != nil {
+		allowed, err = canManageOrganization(ctx, actorID, *orgID)
+	} else {
+		allowed, err = canManageUser(ctx, actorID, *userID)
+	}
+	if err != nil {
+		log.Printf("Failed to check alert settings access: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "Forbidden: manager or admin role required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// AlertSettings - настройки тревоги. GET возвращает действующие настройки пользователя
+// (user_id, по умолчанию свои) или организации (organization_id), POST сохраняет.
+// Применяются со следующего подключения клиента.
+// GET /api/alert-settings[?user_id=2 | ?organization_id=1]
+// POST /api/alert-settings {"user_id": 2, "score_threshold": 0.6, "min_duration_ms": 1500, "cooldown_sec": 60,
+// "smoothing_method": "median", "smoothing_window": 7, "hysteresis": 0.1}
+func AlertSettings(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		getAlertSettings(ctx, w, r, userID)
+	case http.MethodPost:
+		saveAlertSettings(ctx, w, r, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func getAlertSettings(ctx context.Context, w http.ResponseWriter, r *http.Request, viewerID int) {
+	if v := r.URL.Query().Get("organization_id"); v != "" {
+		orgID, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+			return
+		}
+		if !authorizeAlertSettingsChange(ctx, w, viewerID, &orgID, nil) {
+			return
+		}
+
+		settings := alertDefaults
+		settings.OrganizationID = &orgID
+		settings.Source = models.AlertSettingsDefault
+		var updatedAt time.Time
+		err = database.DB.QueryRowContext(ctx,
+			`SELECT score_threshold, min_duration_ms, cooldown_sec,
+				smoothing_method, smoothing_alpha, smoothing_window, hysteresis, updated_at
+			FROM alert_settings WHERE organization_id = $1`,
+			orgID,
+		).Scan(&settings.ScoreThreshold, &settings.MinDurationMs, &settings.CooldownSec,
+			&settings.SmoothingMethod, &settings.SmoothingAlpha, &settings.SmoothingWindow, &settings.Hysteresis, &updatedAt)
+		if err == nil {
+			settings.Source = models.AlertSettingsOrganization
+			settings.UpdatedAt = &updatedAt
+		} else if err != sql.ErrNoRows {
+			log.Printf("Failed to fetch alert settings: %v", err)
+			http.Error(w, "Failed to fetch alert settings", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(settings)
+		return
+	}
+
+	userID, ok := resolveTargetUser(ctx, w, r, viewerID)
+	if !ok {
+		return
+	}
+	settings, err := services.ResolveAlertSettings(ctx, database.DB, userID, alertDefaults)
+	if err != nil {
+		log.Printf("Failed to fetch alert settings: %v", err)
+		http.Error(w, "Failed to fetch alert settings", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(settings)
+}
+
+func saveAlertSettings(ctx context.Context, w http.ResponseWriter, r *http.Request, actorID int) {
+	var req models.AlertSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	applySmoothingDefaults(&req)
+	if msg := validateAlertSettings(req); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if !authorizeAlertSettingsChange(ctx, w, actorID, req.OrganizationID, req.UserID) {
+		return
+	}
+
+	conflict := "user_id"
+	if req.OrganizationID != nil {
+		conflict = "organization_id"
+	}
+	_, err := database.DB.ExecContext(ctx,
+		`INSERT INTO alert_settings (organization_id, user_id, score_threshold, min_duration_ms, cooldown_sec,
+			smoothing_method, smoothing_alpha, smoothing_window, hysteresis, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (`+conflict+`) DO UPDATE SET score_threshold = EXCLUDED.score_threshold,
+			min_duration_ms = EXCLUDED.min_duration_ms, cooldown_sec = EXCLUDED.cooldown_sec,
+			smoothing_method = EXCLUDED.smoothing_method, smoothing_alpha = EXCLUDED.smoothing_alpha,
+			smoothing_window = EXCLUDED.smoothing_window, hysteresis = EXCLUDED.hysteresis, updated_at = EXCLUDED.updated_at`,
+		req.OrganizationID, req.UserID, req.ScoreThreshold, req.MinDurationMs, req.CooldownSec,
+		req.SmoothingMethod, req.SmoothingAlpha, req.SmoothingWindow, *req.Hysteresis, time.Now().UTC(),
+	)
+	if err != nil {
+		log.Printf("Failed to save alert settings: %v", err)
+		http.Error(w, "Failed to save alert settings", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Alert settings saved by user %d: org=%v user=%v", actorID, req.OrganizationID, req.UserID)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Alert settings saved"))
+}
+
+// ResetAlertSettings удаляет настройки пользователя или организации,
+// после чего действуют настройки уровнем выше.
+// DELETE /api/alert-settings/reset?user_id=2 | ?organization_id=1
+func ResetAlertSettings(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	q := r.URL.Query()
+	var orgID, userID *int
+	column, value := "user_id", q.Get("user_id")
+	if value == "" {
+		column, value = "organization_id", q.Get("organization_id")
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		http.Error(w, "user_id or organization_id is required", http.StatusBadRequest)
+		return
+	}
+	if column == "user_id" {
+		userID = &id
+	} else {
+		orgID = &id
+	}
+	if !authorizeAlertSettingsChange(ctx, w, actorID, orgID, userID) {
+		return
+	}
+
+	result, err := database.DB.ExecContext(ctx, "DELETE FROM alert_settings WHERE "+column+" = $1", id)
+	if err != nil {
+		log.Printf("Failed to delete alert settings: %v", err)
+		http.Error(w, "Failed to delete alert settings", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Alert settings not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Alert settings reset"))
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const alertEpisodeColumns = `id, user_id, session_id, client_id, start_time, end_time, peak_score, severity, frames,
+	acknowledged_at, ack_latency_ms, escalation_level, alert_type, reason`
+
+func scanAlertEpisode(rows *sql.Rows) (models.AlertEpisode, error) {
+	var ep models.AlertEpisode
+	var sessionID sql.NullInt64
+	var endTime, ackAt sql.NullTime
+	var ackLatency sql.NullInt64
+	err := rows.Scan(&ep.ID, &ep.UserID, &sessionID, &ep.ClientID, &ep.StartTime, &endTime,
+		&ep.PeakScore, &ep.Severity, &ep.Frames, &ackAt, &ackLatency, &ep.EscalationLevel,
+		&ep.AlertType, &ep.Reason)
+	if sessionID.Valid {
+		id := int(sessionID.Int64)
+		ep.SessionID = &id
+	}
+	if endTime.Valid {
+		ep.EndTime = &endTime.Time
+	}
+	if ackAt.Valid {
+		ep.AcknowledgedAt = &ackAt.Time
+	}
+	if ackLatency.Valid {
+		ep.AckLatencyMs = &ackLatency.Int64
+	}
+	return ep, err
+}
+
+// GetAlertEpisodes возвращает эпизоды тревоги сеанса или пользователя за период.
+// Необязательный type=DROWSINESS|DISTRACTION оставляет эпизоды одного типа.
+// GET /api/alerts?session_id=1[&type=DISTRACTION]
+// GET /api/alerts?from=2024-01-01&to=2024-01-31[&user_id=2]
+func GetAlertEpisodes(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	viewerID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	alertType := r.URL.Query().Get("type")
+	if alertType != "" && alertType != models.AlertTypeDrowsiness && alertType != models.AlertTypeDistraction {
+		http.Error(w, "Invalid alert type", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var query string
+	var args []interface{}
+	if v := r.URL.Query().Get("session_id"); v != "" {
+		sessionID, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+		if !authorizeSessionViewer(w, r, sessionID, viewerID) {
+			return
+		}
+		query = "SELECT " + alertEpisodeColumns + ` FROM alert_episodes
+			WHERE session_id = $1 AND ($2 = '' OR alert_type = $2) ORDER BY start_time`
+		args = []interface{}{sessionID, alertType}
+	} else {
+		from, to, err := parseDateRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userID, ok := resolveTargetUser(ctx, w, r, viewerID)
+		if !ok {
+			return
+		}
+		query = "SELECT " + alertEpisodeColumns + ` FROM alert_episodes
+			WHERE user_id = $1 AND start_time >= $2 AND start_time < $3 AND ($4 = '' OR alert_type = $4)
+			ORDER BY start_time`
+		args = []interface{}{userID, from, to, alertType}
+	}
+
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("Failed to fetch alert episodes: %v", err)
+		http.Error(w, "Failed to fetch alert episodes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	episodes := []models.AlertEpisode{}
+	for rows.Next() {
+		ep, err := scanAlertEpisode(rows)
+		if err != nil {
+			continue
+		}
+		episodes = append(episodes, ep)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(episodes)
+}
+
+// GetAlertAckStats возвращает сводку по подтверждению тревог о сонливости и эскалации за период.
+// GET /api/alerts/ack-stats?from=2024-01-01&to=2024-01-31[&user_id=2]
+func GetAlertAckStats(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	viewerID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userID, ok := resolveTargetUser(ctx, w, r, viewerID)
+	if !ok {
+		return
+	}
+
+	var stats models.AlertAckStats
+	var avg, median, p90 sql.NullFloat64
+	err = database.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*), COUNT(e.acknowledged_at), COUNT(*) FILTER (WHERE e.escalation_level > 0),
+			COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM alert_escalations x WHERE x.episode_id = e.id AND x.action = $4)),
+			COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM alert_escalations x WHERE x.episode_id = e.id AND x.action = $5)),
+			AVG(e.ack_latency_ms),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY e.ack_latency_ms),
+			percentile_cont(0.9) WITHIN GROUP (ORDER BY e.ack_latency_ms)
+		FROM alert_episodes e
+		WHERE e.user_id = $1 AND e.start_time >= $2 AND e.start_time < $3 AND e.alert_type = $6`,
+		userID, from, to, models.EscalationManager, models.EscalationEmergency, models.AlertTypeDrowsiness,
+	).Scan(&stats.Episodes, &stats.Acknowledged, &stats.Escalated, &stats.ReachedManager, &stats.ReachedEmergency,
+		&avg, &median, &p90)
+	if err != nil {
+		log.Printf("Failed to compute alert ack stats: %v", err)
+		http.Error(w, "Failed to compute statistics", http.StatusInternalServerError)
+		return
+	}
+	if avg.Valid {
+		stats.AvgLatencyMs = &avg.Float64
+	}
+	if median.Valid {
+		stats.MedianLatencyMs = &median.Float64
+	}
+	if p90.Valid {
+		stats.P90LatencyMs = &p90.Float64
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
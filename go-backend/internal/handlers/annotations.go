@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Условие для запросов по events e: событие не размечено как ложное срабатывание
+// ни само по себе, ни попаданием в размеченный интервал
+const notFalsePositiveCondition = `NOT EXISTS (
+	SELECT 1 FROM event_annotations a
+	WHERE a.session_id = e.session_id AND a.label = 'false_positive'
+	AND (a.event_id = e.id OR (a.event_id IS NULL AND e.timestamp BETWEEN a.start_time AND a.end_time)))`
+
+func validAnnotationLabel(label string) bool {
+	switch label {
+	case models.LabelTruePositive, models.LabelFalsePositive, models.LabelUnknown:
+		return true
+	}
+	return false
+}
+
+// Параметр exclude_false_positives=true исключает ложные срабатывания из статистики
+func excludeFalsePositives(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("exclude_false_positives"))
+	return v
+}
+
+func scanAnnotation(rows *sql.Rows) (models.Annotation, error) {
+	var a models.Annotation
+	var eventID, authorID sql.NullInt64
+	var startTime, endTime sql.NullTime
+	err := rows.Scan(&a.ID, &a.SessionID, &eventID, &startTime, &endTime, &a.Label, &a.Comment, &authorID, &a.CreatedAt)
+	if err != nil {
+		return a, err
+	}
+	if eventID.Valid {
+		id := int(eventID.Int64)
+		a.EventID = &id
+	}
+	if authorID.Valid {
+		id := int(authorID.Int64)
+		a.AuthorID = &id
+	}
+	if startTime.Valid {
+		a.StartTime = &startTime.Time
+	}
+	if endTime.Valid {
+		a.EndTime = &endTime.Time
+	}
+	return a, nil
+}
+
+func loadSessionAnnotations(ctx context.Context, sessionID int) ([]models.Annotation, error) {
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, session_id, event_id, start_time, end_time, label, comment, author_id, created_at
+		FROM event_annotations WHERE session_id = $1 ORDER BY created_at, id`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	annotations := []models.Annotation{}
+	for rows.Next() {
+		a, err := scanAnnotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, rows.Err()
+}
+
+// Annotations: GET - разметка сеанса, POST - добавить разметку события или интервала.
+// GET /api/annotations?session_id=1
+// POST /api/annotations {"session_id": 1, "event_id": 10, "label": "false_positive", "comment": "очки"}
+func Annotations(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sessionID, err := strconv.Atoi(r.URL.Query().Get("session_id"))
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+		if !authorizeSession(w, r, sessionID, userID) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		annotations, err := loadSessionAnnotations(ctx, sessionID)
+		if err != nil {
+			log.Printf("Failed to fetch annotations: %v", err)
+			http.Error(w, "Failed to fetch annotations", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(annotations)
+
+	case http.MethodPost:
+		createAnnotation(w, r, userID)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func createAnnotation(w http.ResponseWriter, r *http.Request, userID int) {
+	var req models.CreateAnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if !validAnnotationLabel(req.Label) {
+		http.Error(w, "Label must be true_positive, false_positive or unknown", http.StatusBadRequest)
+		return
+	}
+	if req.EventID == nil && (req.StartTime == nil || req.EndTime == nil) {
+		http.Error(w, "Either event_id or start_time and end_time are required", http.StatusBadRequest)
+		return
+	}
+	if req.EventID == nil && req.EndTime.Before(*req.StartTime) {
+		http.Error(w, "end_time must not be before start_time", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeSession(w, r, req.SessionID, userID) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if req.EventID != nil {
+		var eventSessionID int
+		err := database.DB.QueryRowContext(ctx,
+			"SELECT session_id FROM events WHERE id = $1", *req.EventID,
+		).Scan(&eventSessionID)
+		if err == sql.ErrNoRows || (err == nil && eventSessionID != req.SessionID) {
+			http.Error(w, "Event not found in session", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Failed to verify event: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	a := models.Annotation{
+		SessionID: req.SessionID,
+		EventID:   req.EventID,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		Label:     req.Label,
+		Comment:   req.Comment,
+		AuthorID:  &userID,
+	}
+	err := database.DB.QueryRowContext(ctx,
+		`INSERT INTO event_annotations (session_id, event_id, start_time, end_time, label, comment, author_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`,
+		a.SessionID, a.EventID, a.StartTime, a.EndTime, a.Label, a.Comment, userID,
+	).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		log.Printf("Failed to save annotation: %v", err)
+		http.Error(w, "Failed to save annotation", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// DeleteAnnotation удаляет разметку. Удалить может автор или владелец сеанса.
+// POST /api/annotations/delete?id=1
+func DeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	annotationID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid annotation ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.DB.ExecContext(ctx,
+		`DELETE FROM event_annotations a USING sessions s
+		WHERE a.id = $1 AND s.id = a.session_id AND (a.author_id = $2 OR s.user_id = $2)`,
+		annotationID, userID,
+	)
+	if err != nil {
+		log.Printf("Failed to delete annotation: %v", err)
+		http.Error(w, "Failed to delete annotation", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "Annotation not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Annotation deleted"))
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/services"
+	"encoding/json"
+	"net/http"
+)
+
+// GetDetectionCodes возвращает коды статуса кадра и уровня тревоги с подписями.
+// Язык - из lang или Accept-Language, по умолчанию русский.
+// GET /api/detection-codes[?lang=en]
+func GetDetectionCodes(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lang := services.DetectionLanguage(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(services.DetectionCodes(lang))
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EmergencyContact: экстренный контакт водителя, последний шаг эскалации тревоги.
+// Задать контакт может сам пользователь или управляющий им менеджер/администратор.
+// GET /api/emergency-contact[?user_id=2]
+// POST /api/emergency-contact[?user_id=2] {"name": "...", "channel": "email", "target": "a@b.c"}
+func EmergencyContact(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	viewerID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, ok := resolveTargetUser(ctx, w, r, viewerID)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		contact, err := services.LoadEmergencyContact(ctx, database.DB, userID)
+		if err != nil {
+			log.Printf("Failed to fetch emergency contact: %v", err)
+			http.Error(w, "Failed to fetch emergency contact", http.StatusInternalServerError)
+			return
+		}
+		if contact == nil {
+			http.Error(w, "Emergency contact not set", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(contact)
+
+	case http.MethodPost:
+		if userID != viewerID {
+			allowed, err := canManageUser(ctx, viewerID, userID)
+			if err != nil {
+				log.Printf("Failed to check user access: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				http.Error(w, "Forbidden: manager or admin role required", http.StatusForbidden)
+				return
+			}
+		}
+
+		var req models.EmergencyContact
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		req.Target = strings.TrimSpace(req.Target)
+		if ns := services.GetNotificationService(); ns == nil || !ns.HasChannel(req.Channel) {
+			http.Error(w, "Notification channel is not available: "+req.Channel, http.StatusBadRequest)
+			return
+		}
+		if !validateNotificationTarget(req.Channel, req.Target) {
+			http.Error(w, "Invalid target for channel "+req.Channel, http.StatusBadRequest)
+			return
+		}
+
+		contact := models.EmergencyContact{UserID: userID, Name: strings.TrimSpace(req.Name), Channel: req.Channel, Target: req.Target}
+		err := database.DB.QueryRowContext(ctx,
+			`INSERT INTO emergency_contacts (user_id, name, channel, target, updated_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			ON CONFLICT (user_id) DO UPDATE SET name = EXCLUDED.name, channel = EXCLUDED.channel,
+				target = EXCLUDED.target, updated_at = EXCLUDED.updated_at
+			RETURNING updated_at`,
+			contact.UserID, contact.Name, contact.Channel, contact.Target,
+		).Scan(&contact.UpdatedAt)
+		if err != nil {
+			log.Printf("Failed to save emergency contact: %v", err)
+			http.Error(w, "Failed to save emergency contact", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Emergency contact for user %d updated by user %d", userID, viewerID)
+		json.NewEncoder(w).Encode(contact)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
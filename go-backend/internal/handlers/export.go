@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Общая часть запроса: сеанс с событиями, отсортированными по времени,
+// и действующая разметка каждого события (разметка события важнее интервала).
+// Строки читаются курсором, весь сеанс в память не загружается
+const exportSelect = `SELECT s.id, s.user_id, s.start_time, s.end_time, s.status, s.notes, s.vehicle_id, s.state,
+	e.id, e.drowsiness_score, e.is_drowsy, e.timestamp, e.perclos, e.blink_rate, e.long_blinks,
+	ann.label, ann.comment
+	FROM sessions s LEFT JOIN events e ON e.session_id = s.id
+	LEFT JOIN LATERAL (
+		SELECT a.label, a.comment FROM event_annotations a
+		WHERE e.id IS NOT NULL AND a.session_id = s.id
+		AND (a.event_id = e.id OR (a.event_id IS NULL AND e.timestamp BETWEEN a.start_time AND a.end_time))
+		ORDER BY (a.event_id IS NULL), a.created_at DESC LIMIT 1
+	) ann ON true`
+
+// Экспортёр получает сеанс, его события и в конце - полный список разметки сеанса.
+// ann у события - действующая метка (nil, если события не размечены)
+type sessionExporter interface {
+	writeSession(s *models.Session) error
+	writeEvent(e *models.Event, ann *models.Annotation) error
+	writeAnnotations(annotations []models.Annotation) error
+	close() error
+}
+
+func newSessionExporter(format string, w io.Writer) (sessionExporter, string, bool) {
+	switch format {
+	case "", "csv":
+		return &csvExporter{w: csv.NewWriter(w)}, "text/csv; charset=utf-8", true
+	case "json":
+		return &jsonExporter{w: w}, "application/json", true
+	case "ndjson":
+		return &ndjsonExporter{enc: json.NewEncoder(w)}, "application/x-ndjson", true
+	}
+	return nil, "", false
+}
+
+// CSV: одна строка на событие, поля сеанса повторяются, разметка - в колонках события.
+// Сеанс без событий выгружается одной строкой с пустыми полями события
+type csvExporter struct {
+	w       *csv.Writer
+	session *models.Session
+	pending bool
+	header  bool
+}
+
+func (c *csvExporter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.w.Write([]string{
+		"session_id", "user_id", "session_start", "session_end", "session_status", "session_notes",
+		"event_id", "event_timestamp", "drowsiness_score", "is_drowsy", "perclos", "blink_rate", "long_blinks",
+		"annotation_label", "annotation_comment",
+	})
+}
+
+func (c *csvExporter) sessionFields() []string {
+	s := c.session
+	end := ""
+	if s.EndTime != nil {
+		end = s.EndTime.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		strconv.Itoa(s.ID), strconv.Itoa(s.UserID), s.StartTime.UTC().Format(time.RFC3339), end, s.Status, s.Notes,
+	}
+}
+
+func (c *csvExporter) flushPending() error {
+	if !c.pending {
+		return nil
+	}
+	c.pending = false
+	return c.w.Write(append(c.sessionFields(), "", "", "", "", "", "", "", "", ""))
+}
+
+func (c *csvExporter) writeSession(s *models.Session) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	if err := c.flushPending(); err != nil {
+		return err
+	}
+	c.session = s
+	c.pending = true
+	return nil
+}
+
+func (c *csvExporter) writeEvent(e *models.Event, ann *models.Annotation) error {
+	c.pending = false
+	label, comment := "", ""
+	if ann != nil {
+		label, comment = ann.Label, ann.Comment
+	}
+	return c.w.Write(append(c.sessionFields(),
+		strconv.Itoa(e.ID),
+		e.Timestamp.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(e.DrowsinessScore, 'f', -1, 64),
+		strconv.FormatBool(e.IsDrowsy),
+		formatOptionalFloat(e.Perclos),
+		formatOptionalFloat(e.BlinkRate),
+		formatOptionalInt(e.LongBlinks),
+		label,
+		comment,
+	))
+}
+
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func (c *csvExporter) writeAnnotations(annotations []models.Annotation) error {
+	return nil
+}
+
+func (c *csvExporter) close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	if err := c.flushPending(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// JSON: массив [{"session": {...}, "events": [...], "annotations": [...]}], пишется потоково
+type jsonExporter struct {
+	w         io.Writer
+	events    int
+	inSession bool
+}
+
+func (j *jsonExporter) writeSession(s *models.Session) error {
+	prefix := "["
+	if j.inSession {
+		prefix = ","
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(j.w, "%s{\"session\":%s,\"events\":[", prefix, data); err != nil {
+		return err
+	}
+	j.inSession = true
+	j.events = 0
+	return nil
+}
+
+func (j *jsonExporter) writeEvent(e *models.Event, _ *models.Annotation) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if j.events > 0 {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.events++
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonExporter) writeAnnotations(annotations []models.Annotation) error {
+	data, err := json.Marshal(annotations)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(j.w, "],\"annotations\":%s}", data)
+	return err
+}
+
+func (j *jsonExporter) close() error {
+	tail := "[]"
+	if j.inSession {
+		tail = "]"
+	}
+	_, err := io.WriteString(j.w, tail+"\n")
+	return err
+}
+
+// NDJSON: по строке на сеанс, на каждое его событие и на каждую разметку
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonExporter) writeSession(s *models.Session) error {
+	return n.enc.Encode(models.ExportRecord{Type: "session", Session: s})
+}
+
+func (n *ndjsonExporter) writeEvent(e *models.Event, _ *models.Annotation) error {
+	return n.enc.Encode(models.ExportRecord{Type: "event", Event: e})
+}
+
+func (n *ndjsonExporter) writeAnnotations(annotations []models.Annotation) error {
+	for i := range annotations {
+		if err := n.enc.Encode(models.ExportRecord{Type: "annotation", Annotation: &annotations[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ndjsonExporter) close() error {
+	return nil
+}
+
+// Разбирает дату вида 2006-01-02 или RFC3339.
+// Для даты без времени в качестве верхней границы берётся конец дня
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24 * time.Hour)
+	}
+	return t, nil
+}
+
+// Разбирает параметры from/to; при отсутствии берутся последние 30 дней
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -30)
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := parseTimeParam(v, false)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := parseTimeParam(v, true)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// ExportSession выгружает один сеанс со всеми событиями.
+// GET /api/sessions/export?id=1&format=csv|json|ndjson
+func ExportSession(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeSession(w, r, sessionID, userID) {
+		return
+	}
+
+	streamExport(w, r, fmt.Sprintf("session-%d", sessionID),
+		exportSelect+" WHERE s.id = $1 ORDER BY e.timestamp, e.id",
+		sessionID,
+	)
+}
+
+// ExportSessionsRange выгружает все сеансы пользователя, начатые в диапазоне дат.
+// GET /api/sessions/export/range?from=2024-01-01&to=2024-01-31&format=csv|json|ndjson
+func ExportSessionsRange(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	streamExport(w, r, fmt.Sprintf("sessions-%s_%s", from.Format("20060102"), to.Format("20060102")),
+		exportSelect+" WHERE s.user_id = $1 AND s.deleted_at IS NULL AND s.start_time >= $2 AND s.start_time < $3 ORDER BY s.start_time, s.id, e.timestamp, e.id",
+		userID, from, to,
+	)
+}
+
+func streamExport(w http.ResponseWriter, r *http.Request, filename string, query string, args ...interface{}) {
+	format := r.URL.Query().Get("format")
+	exporter, contentType, ok := newSessionExporter(format, w)
+	if !ok {
+		http.Error(w, "Unsupported format, use csv, json or ndjson", http.StatusBadRequest)
+		return
+	}
+	if format == "" {
+		format = "csv"
+	}
+
+	rows, err := database.DB.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		log.Printf("Export query failed: %v", err)
+		http.Error(w, "Failed to export sessions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	// Выгрузка может идти дольше WriteTimeout сервера
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Export: failed to reset write deadline: %v", err)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+format))
+	w.WriteHeader(http.StatusOK)
+
+	// Разметку сеанса дописываем после его событий
+	finishSession := func(sessionID int) bool {
+		if sessionID == 0 {
+			return true
+		}
+		annotations, err := loadSessionAnnotations(r.Context(), sessionID)
+		if err != nil {
+			log.Printf("Export: failed to load annotations for session %d: %v", sessionID, err)
+			return false
+		}
+		if err := exporter.writeAnnotations(annotations); err != nil {
+			log.Printf("Export write failed: %v", err)
+			return false
+		}
+		return true
+	}
+
+	lastSessionID := 0
+	for rows.Next() {
+		var s models.Session
+		var endTime sql.NullTime
+		var notes sql.NullString
+		var eventID sql.NullInt64
+		var score sql.NullFloat64
+		var isDrowsy sql.NullInt64
+		var ts sql.NullTime
+		var perclos, blinkRate *float64
+		var longBlinks *int
+		var label, comment sql.NullString
+
+		if err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &endTime, &s.Status, &notes, &s.VehicleID, &s.State,
+			&eventID, &score, &isDrowsy, &ts, &perclos, &blinkRate, &longBlinks, &label, &comment); err != nil {
+			log.Printf("Export scan failed: %v", err)
+			return
+		}
+
+		if s.ID != lastSessionID {
+			if !finishSession(lastSessionID) {
+				return
+			}
+			if endTime.Valid {
+				s.EndTime = &endTime.Time
+			}
+			s.Notes = notes.String
+			if err := exporter.writeSession(&s); err != nil {
+				log.Printf("Export write failed: %v", err)
+				return
+			}
+			lastSessionID = s.ID
+		}
+
+		if !eventID.Valid {
+			continue
+		}
+		e := models.Event{
+			ID:              int(eventID.Int64),
+			SessionID:       s.ID,
+			DrowsinessScore: score.Float64,
+			IsDrowsy:        isDrowsy.Int64 == 1,
+			Timestamp:       ts.Time,
+			Perclos:         perclos,
+			BlinkRate:       blinkRate,
+			LongBlinks:      longBlinks,
+		}
+		var ann *models.Annotation
+		if label.Valid {
+			ann = &models.Annotation{Label: label.String, Comment: comment.String}
+		}
+		if err := exporter.writeEvent(&e, ann); err != nil {
+			log.Printf("Export write failed: %v", err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Export rows error: %v", err)
+		return
+	}
+	if !finishSession(lastSessionID) {
+		return
+	}
+
+	if err := exporter.close(); err != nil {
+		log.Printf("Export write failed: %v", err)
+	}
+}
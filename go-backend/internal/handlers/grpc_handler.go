@@ -100,6 +100,7 @@ func (h *GRPCHandler) DetectDrowsinessStream(stream pb.DrowsinessDetection_Detec
 				errChan <- err
 				return
 			}
+			services.NormalizeDetection(result)
 			if err := stream.Send(result); err != nil {
 				log.Printf("Client send error: %v", err)
 				errChan <- err
@@ -3,9 +3,11 @@ package handlers
 import (
 	"AI_DETECTOR/go-backend/internal/database"
 	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"regexp"
@@ -70,6 +72,55 @@ func GetUserIDFromCookie(r *http.Request) (int, bool) {
 	return userID, exists
 }
 
+// Проверяет, что сеанс существует и принадлежит пользователю.
+// При отказе сам пишет ответ клиенту и возвращает false
+func authorizeSession(w http.ResponseWriter, r *http.Request, sessionID, userID int) bool {
+	return checkSessionAccess(w, r, sessionID, userID, false)
+}
+
+// Как authorizeSession, но пускает и наблюдающих: администратора и руководителя
+// организации владельца. Только для просмотра в реальном времени и эпизодов тревог
+func authorizeSessionViewer(w http.ResponseWriter, r *http.Request, sessionID, userID int) bool {
+	return checkSessionAccess(w, r, sessionID, userID, true)
+}
+
+func checkSessionAccess(w http.ResponseWriter, r *http.Request, sessionID, userID int, allowViewers bool) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var sessionUserID int
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT user_id FROM sessions WHERE id = $1 AND deleted_at IS NULL",
+		sessionID,
+	).Scan(&sessionUserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		log.Printf("Failed to verify session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if sessionUserID == userID {
+		return true
+	}
+
+	if allowViewers {
+		allowed, err := canViewUser(ctx, userID, sessionUserID)
+		if err != nil {
+			log.Printf("Failed to check user access: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return false
+		}
+		if allowed {
+			return true
+		}
+	}
+
+	http.Error(w, "Unauthorized: session does not belong to user", http.StatusForbidden)
+	return false
+}
+
 func enableCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5000")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
@@ -299,6 +350,26 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+// Не больше одного активного сеанса на пользователя (SINGLE_ACTIVE_SESSION)
+var singleActiveSession bool
+
+func SetSingleActiveSession(enabled bool) {
+	singleActiveSession = enabled
+}
+
+// Наблюдатель начала и завершения сеансов (трансляция супервизорам), задаётся из main
+var sessionObserver func(userID, sessionID int, eventType string, at time.Time)
+
+func SetSessionObserver(fn func(userID, sessionID int, eventType string, at time.Time)) {
+	sessionObserver = fn
+}
+
+func notifySessionObserver(userID, sessionID int, eventType string, at time.Time) {
+	if sessionObserver != nil {
+		sessionObserver(userID, sessionID, eventType, at)
+	}
+}
+
 func CreateSession(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateSessionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -312,33 +383,97 @@ func CreateSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var sessionID int
-	var startTime time.Time
-
-	// Явно используем MSK
-	now := time.Now().UTC()
-
-	err := database.DB.QueryRow(
-		"INSERT INTO sessions (user_id, notes, status, start_time) VALUES ($1, $2, $3, $4) RETURNING id, start_time",
-		userID, req.Notes, "active", now,
-	).Scan(&sessionID, &startTime)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
-	if err != nil {
+	session, err := services.StartSession(ctx, database.DB, userID, req.Notes, req.VehicleID, singleActiveSession)
+	var activeErr *services.ActiveSessionError
+	if errors.As(err, &activeErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   "User already has an active session",
+			"session": activeErr.Session,
+		})
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	notifySessionObserver(userID, session.ID, services.SessionEventStarted, session.StartTime)
+
 	response := map[string]interface{}{
-		"id":         sessionID,
-		"start_time": now,
-		"status":     "active",
-		"notes":      req.Notes,
+		"id":         session.ID,
+		"start_time": session.StartTime,
+		"status":     session.Status,
+		"notes":      session.Notes,
+		"vehicle_id": session.VehicleID,
+		"state":      session.State,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// GetCurrentSession возвращает последний активный сеанс пользователя с текущими счётчиками.
+// GET /api/sessions/current
+func GetCurrentSession(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var cs models.CurrentSession
+	var notes sql.NullString
+	var lastScore sql.NullFloat64
+	var lastEventAt sql.NullTime
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT s.id, s.user_id, s.start_time, s.status, s.notes, s.vehicle_id, s.state,
+			COUNT(e.id), COUNT(e.id) FILTER (WHERE e.is_drowsy = 1), COALESCE(AVG(e.drowsiness_score), 0),
+			MAX(e.timestamp),
+			(SELECT drowsiness_score FROM events WHERE session_id = s.id ORDER BY timestamp DESC, id DESC LIMIT 1)
+		FROM sessions s LEFT JOIN events e ON e.session_id = s.id
+		WHERE s.id = (
+			SELECT id FROM sessions
+			WHERE user_id = $1 AND status = 'active' AND deleted_at IS NULL
+			ORDER BY start_time DESC LIMIT 1
+		)
+		GROUP BY s.id`,
+		userID,
+	).Scan(&cs.ID, &cs.UserID, &cs.StartTime, &cs.Status, &notes, &cs.VehicleID, &cs.State,
+		&cs.EventsCount, &cs.DrowsyCount, &cs.AvgScore, &lastEventAt, &lastScore)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No active session", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Failed to fetch current session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	cs.Notes = notes.String
+	if lastScore.Valid {
+		cs.LastScore = &lastScore.Float64
+	}
+	if lastEventAt.Valid {
+		cs.LastEventAt = &lastEventAt.Time
+	}
+	cs.DurationSec = int64(time.Since(cs.StartTime).Seconds())
+
+	json.NewEncoder(w).Encode(cs)
+}
+
 func GetSessions(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 	if r.Method != http.MethodGet {
@@ -353,7 +488,7 @@ func GetSessions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := database.DB.Query(
-		"SELECT id, user_id, start_time, end_time, status, notes FROM sessions WHERE user_id = $1 ORDER BY start_time DESC",
+		"SELECT id, user_id, start_time, end_time, status, notes, vehicle_id, state FROM sessions WHERE user_id = $1 AND deleted_at IS NULL ORDER BY start_time DESC",
 		userID,
 	)
 
@@ -368,7 +503,7 @@ func GetSessions(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var s models.Session
 		var endTime sql.NullTime
-		err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &endTime, &s.Status, &s.Notes)
+		err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &endTime, &s.Status, &s.Notes, &s.VehicleID, &s.State)
 		if err != nil {
 			continue
 		}
@@ -402,27 +537,27 @@ func EndSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := database.DB.Exec(
-		"UPDATE sessions SET end_time = $1, status = 'completed' WHERE id = $2 AND user_id = $3",
-		time.Now().UTC(), sessionID, userID,
-	)
+	endTime := time.Now().UTC()
+	ended, err := services.EndSession(r.Context(), database.DB, userID, sessionID, endTime)
 	if err != nil {
 		log.Printf("Failed to end session: %v", err)
 		http.Error(w, "Failed to end session", http.StatusInternalServerError)
 		return
 	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Session not found or does not belong to user", http.StatusNotFound)
+	if !ended {
+		http.Error(w, "Session not found or not active", http.StatusNotFound)
 		return
 	}
+	notifySessionObserver(userID, sessionID, services.SessionEventEnded, endTime)
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Session ended"))
 	log.Printf("Session ended: %d", sessionID)
 }
 
+// DeleteSession переносит сеансы в корзину (мягкое удаление).
+// Окончательно они удаляются заданием очистки через SESSION_PURGE_AFTER_DAYS.
+// POST /api/sessions/delete?id=1 или с телом {"ids": [1, 2, 3]}
 func DeleteSession(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
@@ -436,57 +571,45 @@ func DeleteSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionIDStr := r.URL.Query().Get("id")
-	sessionID, err := strconv.Atoi(sessionIDStr)
+	sessionIDs, single, err := parseSessionIDs(r)
 	if err != nil {
-		http.Error(w, "Invalid session ID", http.StatusBadRequest)
-		return
-	}
-
-	// Сначала проверяем, что сеанс принадлежит пользователю
-	var sessionUserID int
-	err = database.DB.QueryRow(
-		"SELECT user_id FROM sessions WHERE id = $1",
-		sessionID,
-	).Scan(&sessionUserID)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Session not found", http.StatusNotFound)
-		return
-	} else if err != nil {
-		log.Printf("Failed to verify session: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if sessionUserID != userID {
-		http.Error(w, "Unauthorized: session does not belong to user", http.StatusForbidden)
+	if single && !authorizeSession(w, r, sessionIDs[0], userID) {
 		return
 	}
 
-	// Удаляем события сеанса
-	_, err = database.DB.Exec("DELETE FROM events WHERE session_id = $1", sessionID)
-	if err != nil {
-		log.Printf("Failed to delete events: %v", err)
-		// Продолжаем удаление сеанса даже если не удалось удалить события
-	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
-	// Удаляем сеанс
-	result, err := database.DB.Exec("DELETE FROM sessions WHERE id = $1 AND user_id = $2", sessionID, userID)
+	deleted, err := updateSessionsReturning(ctx,
+		"UPDATE sessions SET deleted_at = $1 WHERE id = ANY($2) AND user_id = $3 AND deleted_at IS NULL RETURNING id",
+		time.Now().UTC(), sessionIDs, userID,
+	)
 	if err != nil {
 		log.Printf("Failed to delete session: %v", err)
 		http.Error(w, "Failed to delete session", http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Session not found", http.StatusNotFound)
+	if single {
+		if len(deleted) == 0 {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Session deleted"))
+		log.Printf("Session moved to trash: %d", sessionIDs[0])
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Session deleted"))
-	log.Printf("Session deleted: %d", sessionID)
+	log.Printf("Sessions moved to trash by user %d: %v", userID, deleted)
+	json.NewEncoder(w).Encode(models.BulkSessionsResponse{
+		Processed: deleted,
+		NotFound:  missingIDs(sessionIDs, deleted),
+	})
 }
 
 func SaveEvent(w http.ResponseWriter, r *http.Request) {
@@ -508,51 +631,20 @@ func SaveEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-	var sessionUserID int
-	err := database.DB.QueryRowContext(ctx,
-		"SELECT user_id FROM sessions WHERE id = $1",
-		req.SessionID,
-	).Scan(&sessionUserID)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Session not found", http.StatusNotFound)
+	if !authorizeSession(w, r, req.SessionID, userID) {
 		return
-	} else if err != nil {
-		log.Printf("Failed to verify session: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	if sessionUserID != userID {
-		http.Error(w, "Unauthorized: session does not belong to user", http.StatusForbidden)
-		return
-	}
-
-	isDrowsyInt := 0
-	if req.IsDrowsy {
-		isDrowsyInt = 1
 	}
 
-	var eventID int64
-	err = database.DB.QueryRow(
-		"INSERT INTO events (session_id, drowsiness_score, is_drowsy) VALUES ($1, $2, $3) RETURNING id",
-		req.SessionID, req.DrowsinessScore, isDrowsyInt,
-	).Scan(&eventID)
-
-	if err != nil {
+	event, err := services.SaveDetectionEvent(r.Context(), database.DB, req)
+	if errors.Is(err, services.ErrSessionNotActive) {
+		http.Error(w, "Session is not active", http.StatusConflict)
+		return
+	} else if err != nil {
 		log.Printf("Failed to save event: %v", err)
 		http.Error(w, "Failed to save event", http.StatusInternalServerError)
 		return
 	}
 
-	event := models.Event{
-		ID:              int(eventID),
-		SessionID:       req.SessionID,
-		DrowsinessScore: req.DrowsinessScore,
-		IsDrowsy:        req.IsDrowsy,
-		Timestamp:       time.Now().UTC(),
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(event)
@@ -578,28 +670,13 @@ func GetEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-	var sessionUserID int
-	err = database.DB.QueryRowContext(ctx,
-		"SELECT user_id FROM sessions WHERE id = $1",
-		sessionID,
-	).Scan(&sessionUserID)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Session not found", http.StatusNotFound)
-		return
-	} else if err != nil {
-		log.Printf("Failed to verify session: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	if sessionUserID != userID {
-		http.Error(w, "Unauthorized: session does not belong to user", http.StatusForbidden)
+	if !authorizeSession(w, r, sessionID, userID) {
 		return
 	}
 
 	rows, err := database.DB.Query(
-		"SELECT id, session_id, drowsiness_score, is_drowsy, timestamp FROM events WHERE session_id = $1 ORDER BY timestamp DESC",
+		`SELECT id, session_id, drowsiness_score, is_drowsy, timestamp, perclos, blink_rate, long_blinks
+		FROM events WHERE session_id = $1 ORDER BY timestamp DESC`,
 		sessionID,
 	)
 
@@ -613,7 +690,8 @@ func GetEvents(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var e models.Event
 		var isDrowsyInt int
-		err := rows.Scan(&e.ID, &e.SessionID, &e.DrowsinessScore, &isDrowsyInt, &e.Timestamp)
+		err := rows.Scan(&e.ID, &e.SessionID, &e.DrowsinessScore, &isDrowsyInt, &e.Timestamp,
+			&e.Perclos, &e.BlinkRate, &e.LongBlinks)
 		if err != nil {
 			continue
 		}
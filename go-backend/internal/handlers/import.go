@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/services"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const importIdleTimeout = 30 * time.Second
+
+// Продлевает срок чтения тела запроса перед каждым чтением
+type deadlineReader struct {
+	r    io.Reader
+	rc   *http.ResponseController
+	idle time.Duration
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	d.rc.SetReadDeadline(time.Now().Add(d.idle))
+	return d.r.Read(p)
+}
+
+// ImportSessions загружает сеансы текущего пользователя из NDJSON-выгрузки.
+// Тело может быть сжато gzip (Content-Encoding: gzip).
+// POST /api/sessions/import
+func ImportSessions(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Большой архив может читаться дольше таймаутов сервера: срок чтения продлевается,
+	// пока клиент присылает данные, а остановившийся клиент отключается через importIdleTimeout
+	rc := http.NewResponseController(w)
+	var body io.Reader = &deadlineReader{r: r.Body, rc: rc, idle: importIdleTimeout}
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, "Invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	report, err := services.ImportSessions(r.Context(), database.DB, body, services.ImportOptions{
+		UserID: userID,
+	})
+	// Ответ отправляется после чтения всего тела, когда WriteTimeout сервера уже мог истечь
+	rc.SetWriteDeadline(time.Now().Add(importIdleTimeout))
+
+	if err != nil {
+		log.Printf("Import failed for user %d: %v", userID, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidImport) {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  err.Error(),
+			"report": report,
+		})
+		return
+	}
+
+	log.Printf("Import for user %d: %d sessions, %d events, %d duplicates, %d in trash, %d rejected",
+		userID, report.SessionsImported, report.EventsImported, len(report.Duplicates), len(report.InTrash), len(report.Rejected))
+
+	json.NewEncoder(w).Encode(report)
+}
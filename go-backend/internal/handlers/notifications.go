@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func validateNotificationTarget(channel, target string) bool {
+	switch channel {
+	case models.ChannelWebhook:
+		return validateWebhookURL(target)
+	case models.ChannelEmail:
+		addr, err := mail.ParseAddress(target)
+		return err == nil && addr.Address == target
+	case models.ChannelChatBot:
+		return target != "" && !strings.ContainsAny(target, " \t\r\n/")
+	}
+	return false
+}
+
+// Письма с пользовательскими шаблонами уходят только на адрес самого подписчика или
+// пользователя, которым он управляет: иначе сервер рассылал бы произвольный текст на любые адреса
+func canEmailTarget(ctx context.Context, userID int, target string) (bool, error) {
+	var ownerID int
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT id FROM users WHERE lower(email) = lower($1)", target,
+	).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if ownerID == userID {
+		return true, nil
+	}
+	return canManageUser(ctx, userID, ownerID)
+}
+
+// NotificationChannels возвращает каналы уведомлений, настроенные на сервере.
+// GET /api/notifications/channels
+func NotificationChannels(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, exists := GetUserIDFromCookie(r); !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	channels := []string{}
+	if ns := services.GetNotificationService(); ns != nil {
+		channels = ns.Channels()
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"channels": channels})
+}
+
+// NotificationSubscriptions: подписки текущего пользователя и создание новой.
+// Без watch_* подписка получает собственные события пользователя.
+// GET /api/notifications/subscriptions
+// POST /api/notifications/subscriptions {"channel": "email", "target": "a@b.c", "events": ["alert.start"], "watch_user_id": 2}
+func NotificationSubscriptions(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		listSubscriptions(ctx, w, userID)
+	case http.MethodPost:
+		createSubscription(ctx, w, r, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listSubscriptions(ctx context.Context, w http.ResponseWriter, userID int) {
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, subscriber_id, channel, target, events, watch_user_id, watch_organization_id,
+			subject_template, body_template, created_at
+		FROM notification_subscriptions WHERE subscriber_id = $1 ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		log.Printf("Failed to fetch notification subscriptions: %v", err)
+		http.Error(w, "Failed to fetch subscriptions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	subs := []models.NotificationSubscription{}
+	for rows.Next() {
+		var s models.NotificationSubscription
+		var watchUser, watchOrg sql.NullInt64
+		var events string
+		if err := rows.Scan(&s.ID, &s.SubscriberID, &s.Channel, &s.Target, &events, &watchUser, &watchOrg,
+			&s.SubjectTemplate, &s.BodyTemplate, &s.CreatedAt); err != nil {
+			continue
+		}
+		if watchUser.Valid {
+			id := int(watchUser.Int64)
+			s.WatchUserID = &id
+		}
+		if watchOrg.Valid {
+			id := int(watchOrg.Int64)
+			s.WatchOrganizationID = &id
+		}
+		s.Events = strings.Split(events, ",")
+		subs = append(subs, s)
+	}
+
+	json.NewEncoder(w).Encode(subs)
+}
+
+func createSubscription(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int) {
+	var req models.CreateSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	ns := services.GetNotificationService()
+	if ns == nil || !ns.HasChannel(req.Channel) {
+		http.Error(w, "Notification channel is not available: "+req.Channel, http.StatusBadRequest)
+		return
+	}
+	req.Target = strings.TrimSpace(req.Target)
+	if !validateNotificationTarget(req.Channel, req.Target) {
+		http.Error(w, "Invalid target for channel "+req.Channel, http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) == 0 {
+		http.Error(w, "At least one event type is required", http.StatusBadRequest)
+		return
+	}
+	for _, e := range req.Events {
+		if !webhookEventTypes[e] {
+			http.Error(w, "Unknown event type: "+e, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.WatchUserID != nil && req.WatchOrganizationID != nil {
+		http.Error(w, "Specify either watch_user_id or watch_organization_id", http.StatusBadRequest)
+		return
+	}
+	for _, t := range []string{req.SubjectTemplate, req.BodyTemplate} {
+		if err := services.ParseNotificationTemplate(t); err != nil {
+			http.Error(w, "Invalid template: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Channel == models.ChannelEmail {
+		allowed, err := canEmailTarget(ctx, userID, req.Target)
+		if err != nil {
+			log.Printf("Failed to check email target: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Email target must be your own address or the address of a user you manage", http.StatusForbidden)
+			return
+		}
+	}
+
+	var allowed bool
+	var err error
+	switch {
+	case req.WatchUserID != nil:
+		allowed, err = canViewUser(ctx, userID, *req.WatchUserID)
+	case req.WatchOrganizationID != nil:
+		allowed, err = canManageOrganization(ctx, userID, *req.WatchOrganizationID)
+	default:
+		allowed = true
+	}
+	if err != nil {
+		log.Printf("Failed to check subscription access: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	s := models.NotificationSubscription{
+		SubscriberID:        userID,
+		Channel:             req.Channel,
+		Target:              req.Target,
+		Events:              req.Events,
+		WatchUserID:         req.WatchUserID,
+		WatchOrganizationID: req.WatchOrganizationID,
+		SubjectTemplate:     req.SubjectTemplate,
+		BodyTemplate:        req.BodyTemplate,
+	}
+	err = database.DB.QueryRowContext(ctx,
+		`INSERT INTO notification_subscriptions
+			(subscriber_id, channel, target, events, watch_user_id, watch_organization_id, subject_template, body_template)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+		userID, s.Channel, s.Target, strings.Join(s.Events, ","), s.WatchUserID, s.WatchOrganizationID,
+		s.SubjectTemplate, s.BodyTemplate,
+	).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		log.Printf("Failed to create notification subscription: %v", err)
+		http.Error(w, "Failed to create subscription", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Notification subscription %d (%s) created by user %d", s.ID, s.Channel, userID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// Проверяет, что подписка принадлежит пользователю. При отказе сам пишет ответ
+func authorizeSubscription(ctx context.Context, w http.ResponseWriter, userID, subscriptionID int) bool {
+	var ownerID int
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT subscriber_id FROM notification_subscriptions WHERE id = $1", subscriptionID,
+	).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		log.Printf("Failed to fetch notification subscription: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// DeleteNotificationSubscription удаляет подписку вместе с журналом отправок.
+// DELETE /api/notifications/subscriptions/delete?id=1
+func DeleteNotificationSubscription(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	subscriptionID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if !authorizeSubscription(ctx, w, userID, subscriptionID) {
+		return
+	}
+
+	if _, err := database.DB.ExecContext(ctx, "DELETE FROM notification_subscriptions WHERE id = $1", subscriptionID); err != nil {
+		log.Printf("Failed to delete notification subscription: %v", err)
+		http.Error(w, "Failed to delete subscription", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Subscription deleted"))
+	log.Printf("Notification subscription %d deleted by user %d", subscriptionID, userID)
+}
+
+// NotificationLog возвращает последние отправки по подписке.
+// GET /api/notifications/log?subscription_id=1[&limit=50]
+func NotificationLog(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	subscriptionID, err := strconv.Atoi(q.Get("subscription_id"))
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if !authorizeSubscription(ctx, w, userID, subscriptionID) {
+		return
+	}
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, subscription_id, event, status, attempts, error, created_at
+		FROM notification_log WHERE subscription_id = $1
+		ORDER BY created_at DESC, id DESC LIMIT $2`,
+		subscriptionID, limit,
+	)
+	if err != nil {
+		log.Printf("Failed to fetch notification log: %v", err)
+		http.Error(w, "Failed to fetch notification log", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.NotificationLogEntry{}
+	for rows.Next() {
+		var e models.NotificationLogEntry
+		if err := rows.Scan(&e.ID, &e.SubscriptionID, &e.Event, &e.Status, &e.Attempts, &e.Error, &e.CreatedAt); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Порог, выше которого кадр считается сонным (как THRESHOLD в Python-сервисе)
+	reportDrowsyThreshold = 0.5
+	// Разрыв между событиями, после которого эпизод считается завершённым
+	reportEpisodeGap = 10 * time.Second
+	// Максимум точек на графике, остальные усредняются
+	reportMaxChartPoints = 600
+
+	reportChartWidth  = 760
+	reportChartHeight = 180
+)
+
+type reportEpisode struct {
+	Start     time.Time
+	End       time.Time
+	PeakScore float64
+	Frames    int
+}
+
+func (e reportEpisode) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+type reportSummary struct {
+	Sessions     int
+	Events       int
+	DrowsyEvents int
+	Episodes     int
+	AvgScore     float64
+	MaxScore     float64
+	Duration     time.Duration
+	scoreSum     float64
+}
+
+func (s *reportSummary) add(o reportSummary) {
+	s.Sessions += o.Sessions
+	s.Events += o.Events
+	s.DrowsyEvents += o.DrowsyEvents
+	s.Episodes += o.Episodes
+	s.Duration += o.Duration
+	s.scoreSum += o.scoreSum
+	if o.MaxScore > s.MaxScore {
+		s.MaxScore = o.MaxScore
+	}
+	if s.Events > 0 {
+		s.AvgScore = s.scoreSum / float64(s.Events)
+	}
+}
+
+func (s reportSummary) DrowsyPercent() float64 {
+	if s.Events == 0 {
+		return 0
+	}
+	return float64(s.DrowsyEvents) * 100 / float64(s.Events)
+}
+
+type chartRect struct {
+	X, Width, Height float64
+}
+
+type reportChart struct {
+	Width      int
+	Height     int
+	Points     string
+	Threshold  float64
+	ThresholdY float64
+	Episodes   []chartRect
+	StartLabel string
+	EndLabel   string
+	Empty      bool
+}
+
+type sessionReport struct {
+	Session  models.Session
+	Summary  reportSummary
+	Episodes []reportEpisode
+	Chart    reportChart
+}
+
+type reportPage struct {
+	Title                 string
+	Period                string
+	GeneratedAt           time.Time
+	ExcludeFalsePositives bool
+	Sessions              []sessionReport
+	Total                 reportSummary
+}
+
+// Склеивает подряд идущие сонные кадры в эпизоды.
+// События должны быть отсортированы по времени
+func findDrowsyEpisodes(events []models.Event) []reportEpisode {
+	var episodes []reportEpisode
+	var current *reportEpisode
+
+	for _, e := range events {
+		if current != nil && (!e.IsDrowsy || e.Timestamp.Sub(current.End) > reportEpisodeGap) {
+			episodes = append(episodes, *current)
+			current = nil
+		}
+		if !e.IsDrowsy {
+			continue
+		}
+		if current == nil {
+			current = &reportEpisode{Start: e.Timestamp}
+		}
+		current.End = e.Timestamp
+		current.Frames++
+		if e.DrowsinessScore > current.PeakScore {
+			current.PeakScore = e.DrowsinessScore
+		}
+	}
+	if current != nil {
+		episodes = append(episodes, *current)
+	}
+	return episodes
+}
+
+func summarizeSession(s models.Session, events []models.Event, episodes []reportEpisode) reportSummary {
+	summary := reportSummary{Sessions: 1, Events: len(events), Episodes: len(episodes)}
+	for _, e := range events {
+		summary.scoreSum += e.DrowsinessScore
+		if e.DrowsinessScore > summary.MaxScore {
+			summary.MaxScore = e.DrowsinessScore
+		}
+		if e.IsDrowsy {
+			summary.DrowsyEvents++
+		}
+	}
+	if summary.Events > 0 {
+		summary.AvgScore = summary.scoreSum / float64(summary.Events)
+	}
+
+	end := time.Now().UTC()
+	if s.EndTime != nil {
+		end = *s.EndTime
+	} else if len(events) > 0 {
+		end = events[len(events)-1].Timestamp
+	}
+	if end.After(s.StartTime) {
+		summary.Duration = end.Sub(s.StartTime)
+	}
+	return summary
+}
+
+// Строит SVG-график оценки сонливости по времени
+func buildReportChart(events []models.Event, episodes []reportEpisode) reportChart {
+	chart := reportChart{
+		Width:      reportChartWidth,
+		Height:     reportChartHeight,
+		Threshold:  reportDrowsyThreshold,
+		ThresholdY: reportChartHeight * (1 - reportDrowsyThreshold),
+	}
+	if len(events) == 0 {
+		chart.Empty = true
+		return chart
+	}
+
+	start := events[0].Timestamp
+	span := events[len(events)-1].Timestamp.Sub(start).Seconds()
+	chart.StartLabel = start.UTC().Format("15:04:05")
+	chart.EndLabel = events[len(events)-1].Timestamp.UTC().Format("15:04:05")
+
+	xOf := func(t time.Time) float64 {
+		if span <= 0 {
+			return 0
+		}
+		return t.Sub(start).Seconds() / span * reportChartWidth
+	}
+
+	step := 1
+	if len(events) > reportMaxChartPoints {
+		step = (len(events) + reportMaxChartPoints - 1) / reportMaxChartPoints
+	}
+
+	var points strings.Builder
+	for i := 0; i < len(events); i += step {
+		end := i + step
+		if end > len(events) {
+			end = len(events)
+		}
+		sum := 0.0
+		for _, e := range events[i:end] {
+			sum += e.DrowsinessScore
+		}
+		score := sum / float64(end-i)
+		fmt.Fprintf(&points, "%.1f,%.1f ", xOf(events[i].Timestamp), reportChartHeight*(1-score))
+	}
+	chart.Points = strings.TrimSpace(points.String())
+
+	for _, ep := range episodes {
+		x := xOf(ep.Start)
+		width := xOf(ep.End) - x
+		if width < 2 {
+			width = 2
+		}
+		chart.Episodes = append(chart.Episodes, chartRect{X: x, Width: width, Height: reportChartHeight})
+	}
+	return chart
+}
+
+// Загружает события сеанса; при excludeFalsePositives пропускает
+// события, размеченные как ложные срабатывания
+func loadSessionEvents(ctx context.Context, sessionID int, excludeFalsePositives bool) ([]models.Event, error) {
+	query := `SELECT e.id, e.session_id, e.drowsiness_score, e.is_drowsy, e.timestamp, e.perclos, e.blink_rate, e.long_blinks
+		FROM events e WHERE e.session_id = $1`
+	if excludeFalsePositives {
+		query += " AND " + notFalsePositiveCondition
+	}
+	rows, err := database.DB.QueryContext(ctx, query+" ORDER BY e.timestamp, e.id", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		var e models.Event
+		var isDrowsyInt int
+		if err := rows.Scan(&e.ID, &e.SessionID, &e.DrowsinessScore, &isDrowsyInt, &e.Timestamp,
+			&e.Perclos, &e.BlinkRate, &e.LongBlinks); err != nil {
+			return nil, err
+		}
+		e.IsDrowsy = isDrowsyInt == 1
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func loadReportSessions(ctx context.Context, query string, args ...interface{}) ([]models.Session, error) {
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var s models.Session
+		var endTime sql.NullTime
+		var notes sql.NullString
+		if err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &endTime, &s.Status, &notes); err != nil {
+			return nil, err
+		}
+		if endTime.Valid {
+			s.EndTime = &endTime.Time
+		}
+		s.Notes = notes.String
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+const (
+	reportBuildTimeout = 30 * time.Second
+	reportWriteTimeout = 30 * time.Second
+)
+
+// GetSessionReport отдаёт печатный HTML-отчёт по сеансу или по диапазону дат.
+// GET /api/sessions/report?id=1
+// GET /api/sessions/report?from=2024-01-01&to=2024-01-31
+// exclude_false_positives=true убирает размеченные ложные срабатывания из статистики
+func GetSessionReport(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), reportBuildTimeout)
+	defer cancel()
+
+	// Сборка отчёта за большой период может занять дольше WriteTimeout сервера:
+	// продлеваем срок записи на время сборки и отправки страницы
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(reportBuildTimeout + reportWriteTimeout)); err != nil {
+		log.Printf("Report: failed to extend write deadline: %v", err)
+	}
+
+	page := reportPage{GeneratedAt: time.Now().UTC(), ExcludeFalsePositives: excludeFalsePositives(r)}
+	var sessions []models.Session
+	var err error
+
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		sessionID, convErr := strconv.Atoi(idStr)
+		if convErr != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+		if !authorizeSession(w, r, sessionID, userID) {
+			return
+		}
+		page.Title = fmt.Sprintf("Отчёт по сеансу #%d", sessionID)
+		sessions, err = loadReportSessions(ctx,
+			"SELECT id, user_id, start_time, end_time, status, notes FROM sessions WHERE id = $1",
+			sessionID,
+		)
+	} else {
+		from, to, rangeErr := parseDateRange(r)
+		if rangeErr != nil {
+			http.Error(w, rangeErr.Error(), http.StatusBadRequest)
+			return
+		}
+		page.Title = "Отчёт о поездках"
+		page.Period = fmt.Sprintf("%s — %s", from.Format("02.01.2006"), to.Add(-time.Second).Format("02.01.2006"))
+		sessions, err = loadReportSessions(ctx,
+			"SELECT id, user_id, start_time, end_time, status, notes FROM sessions WHERE user_id = $1 AND deleted_at IS NULL AND start_time >= $2 AND start_time < $3 ORDER BY start_time",
+			userID, from, to,
+		)
+	}
+	if err != nil {
+		log.Printf("Report: failed to load sessions: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	for _, s := range sessions {
+		events, err := loadSessionEvents(ctx, s.ID, page.ExcludeFalsePositives)
+		if err != nil {
+			log.Printf("Report: failed to load events for session %d: %v", s.ID, err)
+			http.Error(w, "Failed to build report", http.StatusInternalServerError)
+			return
+		}
+		episodes := findDrowsyEpisodes(events)
+		sr := sessionReport{
+			Session:  s,
+			Summary:  summarizeSession(s, events, episodes),
+			Episodes: episodes,
+			Chart:    buildReportChart(events, episodes),
+		}
+		page.Total.add(sr.Summary)
+		page.Sessions = append(page.Sessions, sr)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := reportTemplate.Execute(w, page); err != nil {
+		log.Printf("Report: template error: %v", err)
+	}
+}
+
+func formatReportDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	if h > 0 {
+		return fmt.Sprintf("%d ч %02d мин", h, m)
+	}
+	if m > 0 {
+		return fmt.Sprintf("%d мин %02d с", m, s)
+	}
+	return fmt.Sprintf("%d с", s)
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"datetime": func(t time.Time) string { return t.UTC().Format("02.01.2006 15:04:05 UTC") },
+	"clock":    func(t time.Time) string { return t.UTC().Format("15:04:05") },
+	"duration": formatReportDuration,
+	"score":    func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"percent":  func(v float64) string { return fmt.Sprintf("%.1f%%", v) },
+	"inc":      func(i int) int { return i + 1 },
+}).Parse(reportHTML))
+
+const reportHTML = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, Arial, sans-serif; color: #1f2933; margin: 24px; }
+h1 { font-size: 22px; margin: 0 0 4px; }
+h2 { font-size: 18px; margin: 28px 0 8px; border-bottom: 1px solid #d9e2ec; padding-bottom: 4px; }
+.muted { color: #627d98; font-size: 13px; }
+table { border-collapse: collapse; width: 100%; margin: 8px 0; font-size: 13px; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #e4e7eb; }
+th { background: #f0f4f8; }
+.stats td:first-child { width: 40%; color: #486581; }
+.notes { white-space: pre-wrap; background: #f7f9fb; padding: 8px; border-left: 3px solid #9fb3c8; }
+.session { page-break-inside: avoid; }
+svg { border: 1px solid #d9e2ec; background: #fff; }
+@media print {
+  body { margin: 0; }
+  .session { page-break-before: always; }
+  .session:first-of-type { page-break-before: auto; }
+}
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Period}}<div class="muted">Период: {{.Period}}</div>{{end}}
+<div class="muted">Сформирован: {{datetime .GeneratedAt}}</div>
+{{if .ExcludeFalsePositives}}<div class="muted">События, размеченные как ложные срабатывания, исключены.</div>{{end}}
+
+<h2>Сводка</h2>
+<table class="stats">
+<tr><td>Сеансов</td><td>{{.Total.Sessions}}</td></tr>
+<tr><td>Общая длительность</td><td>{{duration .Total.Duration}}</td></tr>
+<tr><td>Кадров проанализировано</td><td>{{.Total.Events}}</td></tr>
+<tr><td>Кадров с сонливостью</td><td>{{.Total.DrowsyEvents}} ({{percent .Total.DrowsyPercent}})</td></tr>
+<tr><td>Эпизодов сонливости</td><td>{{.Total.Episodes}}</td></tr>
+<tr><td>Средняя оценка</td><td>{{score .Total.AvgScore}}</td></tr>
+<tr><td>Максимальная оценка</td><td>{{score .Total.MaxScore}}</td></tr>
+</table>
+
+{{range .Sessions}}
+<div class="session">
+<h2>Сеанс #{{.Session.ID}}</h2>
+<div class="muted">
+Начало: {{datetime .Session.StartTime}}
+{{if .Session.EndTime}} · Окончание: {{datetime .Session.EndTime}}{{end}}
+· Статус: {{.Session.Status}}
+</div>
+{{if .Session.Notes}}<p class="notes">{{.Session.Notes}}</p>{{end}}
+
+<table class="stats">
+<tr><td>Длительность</td><td>{{duration .Summary.Duration}}</td></tr>
+<tr><td>Кадров</td><td>{{.Summary.Events}}</td></tr>
+<tr><td>Кадров с сонливостью</td><td>{{.Summary.DrowsyEvents}} ({{percent .Summary.DrowsyPercent}})</td></tr>
+<tr><td>Средняя / максимальная оценка</td><td>{{score .Summary.AvgScore}} / {{score .Summary.MaxScore}}</td></tr>
+</table>
+
+{{with .Chart}}
+{{if .Empty}}
+<p class="muted">Нет событий для построения графика.</p>
+{{else}}
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+{{range .Episodes}}<rect x="{{.X}}" y="0" width="{{.Width}}" height="{{.Height}}" fill="#fde2e2"></rect>{{end}}
+<line x1="0" y1="{{.ThresholdY}}" x2="{{.Width}}" y2="{{.ThresholdY}}" stroke="#e12d39" stroke-dasharray="4 4"></line>
+<polyline points="{{.Points}}" fill="none" stroke="#2680c2" stroke-width="1.5"></polyline>
+</svg>
+<div class="muted">{{.StartLabel}} — {{.EndLabel}} · пунктир: порог {{score .Threshold}}</div>
+{{end}}
+{{end}}
+
+<h3>Эпизоды сонливости</h3>
+{{if .Episodes}}
+<table>
+<tr><th>#</th><th>Начало</th><th>Окончание</th><th>Длительность</th><th>Кадров</th><th>Пиковая оценка</th></tr>
+{{range $i, $e := .Episodes}}
+<tr><td>{{inc $i}}</td><td>{{clock $e.Start}}</td><td>{{clock $e.End}}</td><td>{{duration $e.Duration}}</td><td>{{$e.Frames}}</td><td>{{score $e.PeakScore}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p class="muted">Эпизодов сонливости не зафиксировано.</p>
+{{end}}
+</div>
+{{else}}
+<p class="muted">За выбранный период сеансов нет.</p>
+{{end}}
+</body>
+</html>
+`
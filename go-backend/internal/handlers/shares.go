@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	shareDefaultTTL = 72 * time.Hour
+	shareMaxTTL     = 30 * 24 * time.Hour
+)
+
+// Результаты обращения по ссылке в журнале доступа
+const (
+	shareAccessOK             = "ok"
+	shareAccessExpired        = "expired"
+	shareAccessRevoked        = "revoked"
+	shareAccessSessionDeleted = "session_deleted"
+)
+
+// Ключ подписи токенов, задаётся из конфигурации при запуске
+var shareSecret []byte
+
+func SetShareSecret(secret []byte) {
+	shareSecret = secret
+}
+
+func signShare(payload string) string {
+	mac := hmac.New(sha256.New, shareSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Токен: base64("<id ссылки>.<срок unix>").<подпись HMAC-SHA256>
+func makeShareToken(shareID int, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%d.%d", shareID, expiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + signShare(payload)
+}
+
+func parseShareToken(token string) (int, time.Time, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, time.Time{}, errors.New("malformed token")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, time.Time{}, errors.New("malformed token")
+	}
+	payload := string(raw)
+	if !hmac.Equal([]byte(sig), []byte(signShare(payload))) {
+		return 0, time.Time{}, errors.New("bad signature")
+	}
+
+	idStr, expStr, ok := strings.Cut(payload, ".")
+	if !ok {
+		return 0, time.Time{}, errors.New("malformed token")
+	}
+	shareID, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, time.Time{}, errors.New("malformed token")
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, errors.New("malformed token")
+	}
+	return shareID, time.Unix(exp, 0).UTC(), nil
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func logShareAccess(ctx context.Context, r *http.Request, shareID int, resource, result string) {
+	_, err := database.DB.ExecContext(ctx,
+		"INSERT INTO share_access_log (share_id, resource, result, ip, user_agent) VALUES ($1, $2, $3, $4, $5)",
+		shareID, resource, result, clientIP(r), r.UserAgent(),
+	)
+	if err != nil {
+		log.Printf("Failed to log share access: %v", err)
+	}
+}
+
+// Проверяет токен ссылки и записывает обращение в журнал.
+// Возвращает id ссылки и сеанса; при отказе сам пишет ответ клиенту
+func resolveShare(w http.ResponseWriter, r *http.Request, resource string) (int, int, bool) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get("X-Share-Token")
+	}
+	shareID, tokenExpires, err := parseShareToken(token)
+	if err != nil {
+		http.Error(w, "Invalid share token", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var sessionID int
+	var expiresAt time.Time
+	var revokedAt, deletedAt sql.NullTime
+	err = database.DB.QueryRowContext(ctx,
+		`SELECT sh.session_id, sh.expires_at, sh.revoked_at, s.deleted_at
+		FROM session_shares sh JOIN sessions s ON s.id = sh.session_id WHERE sh.id = $1`,
+		shareID,
+	).Scan(&sessionID, &expiresAt, &revokedAt, &deletedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return 0, 0, false
+	} else if err != nil {
+		log.Printf("Failed to fetch share: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case revokedAt.Valid:
+		logShareAccess(ctx, r, shareID, resource, shareAccessRevoked)
+		http.Error(w, "Share link revoked", http.StatusForbidden)
+		return 0, 0, false
+	case now.After(expiresAt) || now.After(tokenExpires):
+		logShareAccess(ctx, r, shareID, resource, shareAccessExpired)
+		http.Error(w, "Share link expired", http.StatusGone)
+		return 0, 0, false
+	case deletedAt.Valid:
+		logShareAccess(ctx, r, shareID, resource, shareAccessSessionDeleted)
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+
+	logShareAccess(ctx, r, shareID, resource, shareAccessOK)
+	return shareID, sessionID, true
+}
+
+// Shares: список ссылок на сеансы пользователя и создание новой ссылки.
+// GET /api/shares?session_id=1
+// POST /api/shares {"session_id": 1, "expires_in_hours": 72, "label": "страховая"}
+func Shares(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listShares(w, r, userID)
+	case http.MethodPost:
+		createShare(w, r, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listShares(w http.ResponseWriter, r *http.Request, userID int) {
+	query := `SELECT sh.id, sh.session_id, sh.created_by, sh.label, sh.expires_at, sh.revoked_at, sh.created_at,
+		COUNT(l.id), MAX(l.accessed_at)
+		FROM session_shares sh
+		JOIN sessions s ON s.id = sh.session_id
+		LEFT JOIN share_access_log l ON l.share_id = sh.id
+		WHERE s.user_id = $1`
+	args := []interface{}{userID}
+	if idStr := r.URL.Query().Get("session_id"); idStr != "" {
+		sessionID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+		query += " AND sh.session_id = $2"
+		args = append(args, sessionID)
+	}
+	query += " GROUP BY sh.id ORDER BY sh.created_at DESC"
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("Failed to fetch shares: %v", err)
+		http.Error(w, "Failed to fetch shares", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	shares := []models.SessionShare{}
+	for rows.Next() {
+		var sh models.SessionShare
+		var revokedAt, lastAccess sql.NullTime
+		if err := rows.Scan(&sh.ID, &sh.SessionID, &sh.CreatedBy, &sh.Label, &sh.ExpiresAt, &revokedAt,
+			&sh.CreatedAt, &sh.AccessCount, &lastAccess); err != nil {
+			continue
+		}
+		if revokedAt.Valid {
+			sh.RevokedAt = &revokedAt.Time
+		}
+		if lastAccess.Valid {
+			sh.LastAccess = &lastAccess.Time
+		}
+		shares = append(shares, sh)
+	}
+
+	json.NewEncoder(w).Encode(shares)
+}
+
+func createShare(w http.ResponseWriter, r *http.Request, userID int) {
+	var req models.CreateShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	ttl := shareDefaultTTL
+	if req.ExpiresInHours != 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	if ttl <= 0 || ttl > shareMaxTTL {
+		http.Error(w, fmt.Sprintf("expires_in_hours must be between 1 and %d", int(shareMaxTTL.Hours())), http.StatusBadRequest)
+		return
+	}
+	if len(req.Label) > 200 {
+		http.Error(w, "Label is too long", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeSession(w, r, req.SessionID, userID) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Срок обрезается до секунд, чтобы совпадать со сроком в токене
+	sh := models.SessionShare{
+		SessionID: req.SessionID,
+		CreatedBy: userID,
+		Label:     req.Label,
+		ExpiresAt: time.Now().UTC().Add(ttl).Truncate(time.Second),
+	}
+	err := database.DB.QueryRowContext(ctx,
+		"INSERT INTO session_shares (session_id, created_by, label, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		sh.SessionID, sh.CreatedBy, sh.Label, sh.ExpiresAt,
+	).Scan(&sh.ID, &sh.CreatedAt)
+	if err != nil {
+		log.Printf("Failed to create share: %v", err)
+		http.Error(w, "Failed to create share", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Share %d created for session %d by user %d", sh.ID, sh.SessionID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.CreateShareResponse{
+		Share: sh,
+		Token: makeShareToken(sh.ID, sh.ExpiresAt),
+	})
+}
+
+// Проверяет, что ссылка относится к сеансу пользователя
+func authorizeShareOwner(w http.ResponseWriter, r *http.Request, userID int) (int, bool) {
+	shareID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid share ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	var ownerID int
+	err = database.DB.QueryRowContext(r.Context(),
+		"SELECT s.user_id FROM session_shares sh JOIN sessions s ON s.id = sh.session_id WHERE sh.id = $1",
+		shareID,
+	).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return 0, false
+	} else if err != nil {
+		log.Printf("Failed to fetch share: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	return shareID, true
+}
+
+// RevokeShare отзывает ссылку; уже открытые по ней потоки закрываются при следующей проверке.
+// POST /api/shares/revoke?id=1
+func RevokeShare(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	shareID, ok := authorizeShareOwner(w, r, userID)
+	if !ok {
+		return
+	}
+
+	_, err := database.DB.ExecContext(r.Context(),
+		"UPDATE session_shares SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL",
+		time.Now().UTC(), shareID,
+	)
+	if err != nil {
+		log.Printf("Failed to revoke share: %v", err)
+		http.Error(w, "Failed to revoke share", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Share revoked"))
+	log.Printf("Share %d revoked by user %d", shareID, userID)
+}
+
+// ShareAccessLog возвращает журнал обращений по ссылке (последние 500).
+// GET /api/shares/log?id=1
+func ShareAccessLog(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	shareID, ok := authorizeShareOwner(w, r, userID)
+	if !ok {
+		return
+	}
+
+	rows, err := database.DB.QueryContext(r.Context(),
+		`SELECT id, share_id, resource, result, ip, user_agent, accessed_at
+		FROM share_access_log WHERE share_id = $1 ORDER BY accessed_at DESC LIMIT 500`,
+		shareID,
+	)
+	if err != nil {
+		log.Printf("Failed to fetch share log: %v", err)
+		http.Error(w, "Failed to fetch share log", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.ShareAccess{}
+	for rows.Next() {
+		var a models.ShareAccess
+		if err := rows.Scan(&a.ID, &a.ShareID, &a.Resource, &a.Result, &a.IP, &a.UserAgent, &a.AccessedAt); err != nil {
+			continue
+		}
+		entries = append(entries, a)
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
+
+// SharedSession отдаёт сводку сеанса по ссылке, без заметок владельца.
+// GET /api/shared/session?token=...
+func SharedSession(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, sessionID, ok := resolveShare(w, r, "session")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := loadReportSessions(ctx,
+		"SELECT id, user_id, start_time, end_time, status, notes FROM sessions WHERE id = $1", sessionID)
+	if err != nil || len(sessions) == 0 {
+		log.Printf("Failed to fetch shared session %d: %v", sessionID, err)
+		http.Error(w, "Failed to fetch session", http.StatusInternalServerError)
+		return
+	}
+	events, err := loadSessionEvents(ctx, sessionID, false)
+	if err != nil {
+		log.Printf("Failed to fetch shared session events: %v", err)
+		http.Error(w, "Failed to fetch events", http.StatusInternalServerError)
+		return
+	}
+
+	s := sessions[0]
+	s.Notes = ""
+	episodes := findDrowsyEpisodes(events)
+	summary := summarizeSession(s, events, episodes)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.SessionSummary{
+		Session:     s,
+		EventsCount: summary.Events,
+		DrowsyCount: summary.DrowsyEvents,
+		Episodes:    summary.Episodes,
+		AvgScore:    summary.AvgScore,
+		MaxScore:    summary.MaxScore,
+		DurationSec: int64(summary.Duration.Seconds()),
+	})
+}
+
+// SharedEvents отдаёт события сеанса по ссылке в порядке времени.
+// GET /api/shared/events?token=...
+func SharedEvents(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, sessionID, ok := resolveShare(w, r, "events")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	events, err := loadSessionEvents(ctx, sessionID, false)
+	if err != nil {
+		log.Printf("Failed to fetch shared session events: %v", err)
+		http.Error(w, "Failed to fetch events", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []models.Event{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// SharedStream - живой поток событий сеанса по ссылке (SSE). Поток закрывается, когда ссылку
+// отзывают, срок её действия истекает или сеанс переносят в корзину.
+// GET /api/shared/stream?token=...
+func SharedStream(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	shareID, sessionID, ok := resolveShare(w, r, "stream")
+	if !ok {
+		return
+	}
+
+	serveSessionStream(w, r, sessionID, fmt.Sprintf("share %d", shareID), func(ctx context.Context) bool {
+		var valid bool
+		err := database.DB.QueryRowContext(ctx,
+			`SELECT sh.revoked_at IS NULL AND sh.expires_at > $2 AND s.deleted_at IS NULL
+			FROM session_shares sh JOIN sessions s ON s.id = sh.session_id WHERE sh.id = $1`,
+			shareID, time.Now().UTC(),
+		).Scan(&valid)
+		return err == nil && valid
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Интервал комментариев-пингов, чтобы прокси не закрывали простаивающее соединение
+const streamHeartbeat = 15 * time.Second
+
+func writeSSE(w http.ResponseWriter, evt services.SessionEvent) error {
+	data, err := json.Marshal(evt.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", evt.ID, evt.Type, data)
+	return err
+}
+
+// StreamSession транслирует события сеанса (детекции, эпизоды тревоги, завершение)
+// в формате Server-Sent Events. Поддерживает продолжение по заголовку Last-Event-ID.
+// GET /api/sessions/stream?id=1
+func StreamSession(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeSessionViewer(w, r, sessionID, userID) {
+		return
+	}
+
+	serveSessionStream(w, r, sessionID, fmt.Sprintf("user %d", userID), nil)
+}
+
+// Отдаёт поток событий уже проверенного сеанса; viewer - для журнала.
+// stillAllowed, если задан, проверяется на каждом пинге и закрывает поток при отказе
+func serveSessionStream(w http.ResponseWriter, r *http.Request, sessionID int, viewer string, stillAllowed func(ctx context.Context) bool) {
+	// EventSource передаёт заголовок сам, параметр - для клиентов, которые так не умеют
+	lastIDStr := r.Header.Get("Last-Event-ID")
+	if lastIDStr == "" {
+		lastIDStr = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventID uint64
+	if lastIDStr != "" {
+		var err error
+		lastEventID, err = strconv.ParseUint(lastIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// Поток живёт дольше WriteTimeout сервера
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Stream: failed to reset write deadline: %v", err)
+	}
+
+	missed, events, unsubscribe := services.GetSessionEventBus().Subscribe(sessionID, lastEventID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, evt := range missed {
+		if err := writeSSE(w, evt); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("Stream: flush not supported: %v", err)
+		return
+	}
+
+	log.Printf("Stream opened: session %d, %s", sessionID, viewer)
+	defer log.Printf("Stream closed: session %d, %s", sessionID, viewer)
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case evt, ok := <-events:
+			if !ok {
+				// Подписчик отстал и отключён; клиент переподключится с Last-Event-ID
+				return
+			}
+			if err := writeSSE(w, evt); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if stillAllowed != nil && !stillAllowed(r.Context()) {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
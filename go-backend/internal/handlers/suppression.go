@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Право менять правила подавления: правила пользователя - сам пользователь
+// или управляющий им менеджер/администратор, правила транспорта - администратор или
+// менеджер организации правила. Правила транспорта без организации - только администратор
+func canManageSuppression(ctx context.Context, actorID int, userID, orgID *int) (bool, error) {
+	if userID != nil {
+		if *userID == actorID {
+			return true, nil
+		}
+		return canManageUser(ctx, actorID, *userID)
+	}
+	if orgID != nil {
+		return canManageOrganization(ctx, actorID, *orgID)
+	}
+	role, err := getUserRole(ctx, actorID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return role == models.RoleAdmin, err
+}
+
+// Роль и организация пользователя
+func getUserScope(ctx context.Context, userID int) (string, *int, error) {
+	var role string
+	var org sql.NullInt64
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT role, organization_id FROM users WHERE id = $1", userID,
+	).Scan(&role, &org)
+	if !org.Valid {
+		return role, nil, err
+	}
+	id := int(org.Int64)
+	return role, &id, err
+}
+
+// SuppressionRules: правила подавления тревог пользователя или транспортного средства.
+// GET /api/suppression-rules[?user_id=2 | ?vehicle_id=A123BC]
+// POST /api/suppression-rules {"user_id": 2, "kind": "daily", "daily_start": "12:00", "daily_end": "13:00", "timezone": "Europe/Moscow"}
+// POST /api/suppression-rules {"vehicle_id": "A123BC", "kind": "session_state", "states": ["parking", "loading"]}
+func SuppressionRules(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		listSuppressionRules(ctx, w, r, userID)
+	case http.MethodPost:
+		createSuppressionRule(ctx, w, r, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listSuppressionRules(ctx context.Context, w http.ResponseWriter, r *http.Request, viewerID int) {
+	var query string
+	var args []interface{}
+	if vehicleID := r.URL.Query().Get("vehicle_id"); vehicleID != "" {
+		// Менеджер видит правила транспорта своей организации, администратор - все
+		role, org, err := getUserScope(ctx, viewerID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Failed to check suppression access: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		switch {
+		case role == models.RoleAdmin:
+			query = "SELECT " + services.SuppressionRuleColumns + " FROM suppression_rules WHERE vehicle_id = $1 ORDER BY id"
+			args = []interface{}{vehicleID}
+		case role == models.RoleManager && org != nil:
+			query = "SELECT " + services.SuppressionRuleColumns +
+				" FROM suppression_rules WHERE vehicle_id = $1 AND organization_id = $2 ORDER BY id"
+			args = []interface{}{vehicleID, *org}
+		default:
+			http.Error(w, "Forbidden: manager or admin role required", http.StatusForbidden)
+			return
+		}
+	} else {
+		userID, ok := resolveTargetUser(ctx, w, r, viewerID)
+		if !ok {
+			return
+		}
+		query = "SELECT " + services.SuppressionRuleColumns + " FROM suppression_rules WHERE user_id = $1 ORDER BY id"
+		args = []interface{}{userID}
+	}
+
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("Failed to fetch suppression rules: %v", err)
+		http.Error(w, "Failed to fetch suppression rules", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	rules := []models.SuppressionRule{}
+	for rows.Next() {
+		rule, err := services.ScanSuppressionRule(rows)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	json.NewEncoder(w).Encode(rules)
+}
+
+func createSuppressionRule(ctx context.Context, w http.ResponseWriter, r *http.Request, actorID int) {
+	var req models.SuppressionRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.VehicleID != nil {
+		v := strings.TrimSpace(*req.VehicleID)
+		req.VehicleID = &v
+		if v == "" {
+			req.VehicleID = nil
+		}
+	}
+	if (req.UserID == nil) == (req.VehicleID == nil) {
+		http.Error(w, "Exactly one of user_id or vehicle_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+
+	// Правило транспорта относится к организации: по умолчанию - к организации автора
+	var orgID *int
+	if req.VehicleID != nil {
+		orgID = req.OrganizationID
+		if orgID == nil {
+			_, org, err := getUserScope(ctx, actorID)
+			if err != nil && err != sql.ErrNoRows {
+				log.Printf("Failed to load user %d: %v", actorID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			orgID = org
+		}
+		if orgID == nil {
+			http.Error(w, "organization_id is required for vehicle rules", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rule := models.SuppressionRule{
+		UserID:         req.UserID,
+		VehicleID:      req.VehicleID,
+		OrganizationID: orgID,
+		Kind:           req.Kind,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		DailyStart:     req.DailyStart,
+		DailyEnd:       req.DailyEnd,
+		Timezone:       req.Timezone,
+		States:         req.States,
+		Reason:         strings.TrimSpace(req.Reason),
+		Source:         "api",
+		CreatedBy:      &actorID,
+	}
+	if err := services.ValidateSuppressionRule(rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := canManageSuppression(ctx, actorID, rule.UserID, rule.OrganizationID)
+	if err != nil {
+		log.Printf("Failed to check suppression access: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	err = database.DB.QueryRowContext(ctx,
+		`INSERT INTO suppression_rules (user_id, vehicle_id, organization_id, kind, starts_at, ends_at, daily_start, daily_end,
+			timezone, states, reason, source, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id, created_at`,
+		rule.UserID, rule.VehicleID, rule.OrganizationID, rule.Kind, rule.StartsAt, rule.EndsAt, rule.DailyStart, rule.DailyEnd,
+		rule.Timezone, strings.Join(rule.States, ","), rule.Reason, rule.Source, actorID,
+	).Scan(&rule.ID, &rule.CreatedAt)
+	if err != nil {
+		log.Printf("Failed to create suppression rule: %v", err)
+		http.Error(w, "Failed to create suppression rule", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Suppression rule %d (%s) created by user %d", rule.ID, rule.Kind, actorID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// DeleteSuppressionRule удаляет правило подавления; подавленные им тревоги остаются в журнале.
+// DELETE /api/suppression-rules/delete?id=1
+func DeleteSuppressionRule(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ruleID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var ruleUser, ruleOrg sql.NullInt64
+	err = database.DB.QueryRowContext(ctx,
+		"SELECT user_id, organization_id FROM suppression_rules WHERE id = $1", ruleID,
+	).Scan(&ruleUser, &ruleOrg)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Suppression rule not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Failed to fetch suppression rule: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var target, org *int
+	if ruleUser.Valid {
+		id := int(ruleUser.Int64)
+		target = &id
+	}
+	if ruleOrg.Valid {
+		id := int(ruleOrg.Int64)
+		org = &id
+	}
+	allowed, err := canManageSuppression(ctx, actorID, target, org)
+	if err != nil {
+		log.Printf("Failed to check suppression access: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Suppression rule not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := database.DB.ExecContext(ctx, "DELETE FROM suppression_rules WHERE id = $1", ruleID); err != nil {
+		log.Printf("Failed to delete suppression rule: %v", err)
+		http.Error(w, "Failed to delete suppression rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Suppression rule deleted"))
+	log.Printf("Suppression rule %d deleted by user %d", ruleID, actorID)
+}
+
+// GetSuppressedAlerts возвращает тревоги, подавленные правилами, для аудита.
+// GET /api/alerts/suppressed?from=2024-01-01&to=2024-01-31[&user_id=2]
+func GetSuppressedAlerts(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	viewerID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userID, ok := resolveTargetUser(ctx, w, r, viewerID)
+	if !ok {
+		return
+	}
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, user_id, session_id, rule_id, alert_type, reason, client_id, start_time, end_time, peak_score, severity, frames
+		FROM suppressed_alerts WHERE user_id = $1 AND start_time >= $2 AND start_time < $3 ORDER BY start_time`,
+		userID, from, to,
+	)
+	if err != nil {
+		log.Printf("Failed to fetch suppressed alerts: %v", err)
+		http.Error(w, "Failed to fetch suppressed alerts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	alerts := []models.SuppressedAlert{}
+	for rows.Next() {
+		var a models.SuppressedAlert
+		var sessionID, ruleID sql.NullInt64
+		var endTime sql.NullTime
+		if err := rows.Scan(&a.ID, &a.UserID, &sessionID, &ruleID, &a.AlertType, &a.Reason, &a.ClientID, &a.StartTime, &endTime,
+			&a.PeakScore, &a.Severity, &a.Frames); err != nil {
+			continue
+		}
+		if sessionID.Valid {
+			id := int(sessionID.Int64)
+			a.SessionID = &id
+		}
+		if ruleID.Valid {
+			id := int(ruleID.Int64)
+			a.RuleID = &id
+		}
+		if endTime.Valid {
+			a.EndTime = &endTime.Time
+		}
+		alerts = append(alerts, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+// SetSessionState меняет состояние сеанса (движение, стоянка, погрузка, калибровка).
+// POST /api/sessions/state?id=1 {"state": "parking"}
+func SetSessionState(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SessionStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	switch req.State {
+	case models.SessionStateDriving, models.SessionStateParking, models.SessionStateLoading, models.SessionStateCalibration:
+	default:
+		http.Error(w, "Unknown session state: "+req.State, http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeSession(w, r, sessionID, userID) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.DB.ExecContext(ctx,
+		"UPDATE sessions SET state = $1 WHERE id = $2 AND status = 'active' AND deleted_at IS NULL",
+		req.State, sessionID,
+	)
+	if err != nil {
+		log.Printf("Failed to update session state: %v", err)
+		http.Error(w, "Failed to update session state", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Session is not active", http.StatusConflict)
+		return
+	}
+
+	log.Printf("Session %d state set to %s", sessionID, req.State)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": sessionID, "state": req.State})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Срок хранения сеансов в корзине, задаётся из конфигурации при запуске
+var trashRetention = 30 * 24 * time.Hour
+
+func SetTrashRetention(d time.Duration) {
+	trashRetention = d
+}
+
+// Читает ID сеансов из параметра id или из тела {"ids": [...]}.
+// single=true, если сеанс передан параметром
+func parseSessionIDs(r *http.Request) ([]int, bool, error) {
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		sessionID, err := strconv.Atoi(idStr)
+		if err != nil {
+			return nil, false, errors.New("Invalid session ID")
+		}
+		return []int{sessionID}, true, nil
+	}
+
+	var req models.BulkSessionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, false, errors.New("Invalid request")
+	}
+	if len(req.IDs) == 0 {
+		return nil, false, errors.New("Session IDs are required")
+	}
+	if len(req.IDs) > 500 {
+		return nil, false, errors.New("Too many session IDs, max 500")
+	}
+	return req.IDs, false, nil
+}
+
+func updateSessionsReturning(ctx context.Context, query string, args ...interface{}) ([]int, error) {
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func missingIDs(requested, processed []int) []int {
+	done := make(map[int]bool, len(processed))
+	for _, id := range processed {
+		done[id] = true
+	}
+	missing := []int{}
+	for _, id := range requested {
+		if !done[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// ListTrash возвращает удалённые сеансы пользователя и время их окончательного удаления.
+// GET /api/sessions/trash
+func ListTrash(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, user_id, start_time, end_time, status, notes, deleted_at
+		FROM sessions WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`,
+		userID,
+	)
+	if err != nil {
+		log.Printf("Failed to fetch trash: %v", err)
+		http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []models.TrashedSession{}
+	for rows.Next() {
+		var s models.TrashedSession
+		var endTime sql.NullTime
+		var notes sql.NullString
+		var deletedAt time.Time
+		if err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &endTime, &s.Status, &notes, &deletedAt); err != nil {
+			continue
+		}
+		if endTime.Valid {
+			s.EndTime = &endTime.Time
+		}
+		s.Notes = notes.String
+		s.DeletedAt = &deletedAt
+		s.PurgeAt = deletedAt.Add(trashRetention)
+		sessions = append(sessions, s)
+	}
+
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RestoreSessions возвращает сеансы из корзины. При SINGLE_ACTIVE_SESSION восстановленный
+// активный сеанс завершается, если у пользователя уже есть активный.
+// POST /api/sessions/restore?id=1 или с телом {"ids": [1, 2, 3]}
+func RestoreSessions(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionIDs, single, err := parseSessionIDs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restored, err := services.RestoreSessions(ctx, database.DB, userID, sessionIDs, singleActiveSession)
+	if err != nil {
+		log.Printf("Failed to restore sessions: %v", err)
+		http.Error(w, "Failed to restore session", http.StatusInternalServerError)
+		return
+	}
+
+	if single {
+		if len(restored) == 0 {
+			http.Error(w, "Session not found in trash", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Session restored"))
+		log.Printf("Session restored: %d", sessionIDs[0])
+		return
+	}
+
+	log.Printf("Sessions restored by user %d: %v", userID, restored)
+	json.NewEncoder(w).Encode(models.BulkSessionsResponse{
+		Processed: restored,
+		NotFound:  missingIDs(sessionIDs, restored),
+	})
+}
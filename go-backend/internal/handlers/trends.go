@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	// Длительность последнего кадра сеанса, после которого нет следующего события
+	trendLastFrameDuration = time.Second
+	// Изменение частоты эпизодов в час, которое считается незначимым
+	trendStableThreshold = 0.1
+)
+
+// Накопитель статистики по интервалам отчёта
+type trendAccumulator struct {
+	loc       *time.Location
+	buckets   []models.TrendBucket
+	sessions  []map[int]bool
+	timeOfDay []models.TimeOfDayBucket
+	// Граница, начиная с которой данные идут в почасовую гистограмму (предыдущий период не входит)
+	histogramFrom time.Time
+}
+
+func bucketStart(t time.Time, period string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	if period == "week" {
+		// Недели начинаются с понедельника
+		offset := (int(day.Weekday()) + 6) % 7
+		day = day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+func nextBucket(t time.Time, period string) time.Time {
+	if period == "week" {
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+func newTrendAccumulator(from, to time.Time, period string, loc *time.Location, histogramFrom time.Time) *trendAccumulator {
+	acc := &trendAccumulator{loc: loc, histogramFrom: histogramFrom}
+	for start := from; start.Before(to); start = nextBucket(start, period) {
+		acc.buckets = append(acc.buckets, models.TrendBucket{Start: start, End: nextBucket(start, period)})
+		acc.sessions = append(acc.sessions, make(map[int]bool))
+	}
+	acc.timeOfDay = make([]models.TimeOfDayBucket, 24)
+	for h := range acc.timeOfDay {
+		acc.timeOfDay[h].Hour = h
+	}
+	return acc
+}
+
+func (acc *trendAccumulator) index(t time.Time) int {
+	i := sort.Search(len(acc.buckets), func(i int) bool { return acc.buckets[i].End.After(t) })
+	if i == len(acc.buckets) || t.Before(acc.buckets[i].Start) {
+		return -1
+	}
+	return i
+}
+
+// Распределяет время сеанса по интервалам
+func (acc *trendAccumulator) addSession(sessionID int, start, end time.Time) {
+	for i := range acc.buckets {
+		b := &acc.buckets[i]
+		from, to := start, end
+		if from.Before(b.Start) {
+			from = b.Start
+		}
+		if to.After(b.End) {
+			to = b.End
+		}
+		if !to.After(from) {
+			continue
+		}
+		b.HoursMonitored += to.Sub(from).Hours()
+		acc.sessions[i][sessionID] = true
+	}
+}
+
+func (acc *trendAccumulator) addDrowsy(at time.Time, d time.Duration) {
+	if i := acc.index(at); i >= 0 {
+		acc.buckets[i].DrowsyMinutes += d.Minutes()
+	}
+	if !at.Before(acc.histogramFrom) {
+		acc.timeOfDay[at.In(acc.loc).Hour()].DrowsyMinutes += d.Minutes()
+	}
+}
+
+func (acc *trendAccumulator) addEpisode(at time.Time) {
+	if i := acc.index(at); i >= 0 {
+		acc.buckets[i].Episodes++
+	}
+	if !at.Before(acc.histogramFrom) {
+		acc.timeOfDay[at.In(acc.loc).Hour()].Episodes++
+	}
+}
+
+func finalizeBucket(b *models.TrendBucket) {
+	if b.HoursMonitored > 0 {
+		b.EpisodesPerHour = float64(b.Episodes) / b.HoursMonitored
+	}
+	b.HoursMonitored = roundTo(b.HoursMonitored, 2)
+	b.DrowsyMinutes = roundTo(b.DrowsyMinutes, 2)
+	b.EpisodesPerHour = roundTo(b.EpisodesPerHour, 2)
+}
+
+func roundTo(v float64, digits int) float64 {
+	p := math.Pow(10, float64(digits))
+	return math.Round(v*p) / p
+}
+
+// Сравнивает интервал с предыдущим: рост эпизодов в час - ухудшение
+func compareTrend(cur, prev models.TrendBucket) *models.TrendChange {
+	change := &models.TrendChange{
+		EpisodesPerHourChange: roundTo(cur.EpisodesPerHour-prev.EpisodesPerHour, 2),
+		Direction:             "stable",
+	}
+	if prev.DrowsyMinutes > 0 {
+		pct := roundTo((cur.DrowsyMinutes-prev.DrowsyMinutes)*100/prev.DrowsyMinutes, 1)
+		change.DrowsyMinutesPct = &pct
+	}
+	switch {
+	case cur.HoursMonitored == 0 || prev.HoursMonitored == 0:
+		change.Direction = "insufficient_data"
+	case change.EpisodesPerHourChange > trendStableThreshold:
+		change.Direction = "worsening"
+	case change.EpisodesPerHourChange < -trendStableThreshold:
+		change.Direction = "improving"
+	}
+	return change
+}
+
+func sumBuckets(buckets []models.TrendBucket, sessions []map[int]bool) models.TrendBucket {
+	var total models.TrendBucket
+	seen := make(map[int]bool)
+	for i, b := range buckets {
+		if i == 0 {
+			total.Start = b.Start
+		}
+		total.End = b.End
+		total.HoursMonitored += b.HoursMonitored
+		total.DrowsyMinutes += b.DrowsyMinutes
+		total.Episodes += b.Episodes
+		for id := range sessions[i] {
+			seen[id] = true
+		}
+	}
+	total.Sessions = len(seen)
+	return total
+}
+
+func (acc *trendAccumulator) loadSessions(ctx context.Context, userID int, from, to time.Time) error {
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, start_time, end_time FROM sessions
+		WHERE user_id = $1 AND deleted_at IS NULL AND start_time < $3 AND COALESCE(end_time, NOW()) > $2`,
+		userID, from, to,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	now := time.Now().UTC()
+	for rows.Next() {
+		var id int
+		var start time.Time
+		var end sql.NullTime
+		if err := rows.Scan(&id, &start, &end); err != nil {
+			return err
+		}
+		stop := now
+		if end.Valid {
+			stop = end.Time
+		}
+		acc.addSession(id, start, stop)
+	}
+	return rows.Err()
+}
+
+// Проходит по событиям курсором: время сонливости считается от кадра до следующего
+// (не больше reportEpisodeGap), эпизоды выделяются по тем же правилам, что и в HTML-отчёте
+func (acc *trendAccumulator) loadEvents(ctx context.Context, userID int, from, to time.Time, excludeFP bool) error {
+	query := `SELECT e.session_id, e.timestamp, e.is_drowsy FROM events e
+		JOIN sessions s ON s.id = e.session_id
+		WHERE s.user_id = $1 AND s.deleted_at IS NULL AND e.timestamp >= $2 AND e.timestamp < $3`
+	if excludeFP {
+		query += " AND " + notFalsePositiveCondition
+	}
+	rows, err := database.DB.QueryContext(ctx, query+" ORDER BY e.session_id, e.timestamp, e.id", userID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var prevSession int
+	var prevTime time.Time
+	prevDrowsy := false
+
+	flushPrev := func(next time.Time, sameSession bool) {
+		if !prevDrowsy {
+			return
+		}
+		d := trendLastFrameDuration
+		if sameSession {
+			d = next.Sub(prevTime)
+			if d > reportEpisodeGap {
+				d = trendLastFrameDuration
+			}
+		}
+		acc.addDrowsy(prevTime, d)
+	}
+
+	for rows.Next() {
+		var sessionID, isDrowsyInt int
+		var ts time.Time
+		if err := rows.Scan(&sessionID, &ts, &isDrowsyInt); err != nil {
+			return err
+		}
+		isDrowsy := isDrowsyInt == 1
+		sameSession := sessionID == prevSession
+
+		flushPrev(ts, sameSession)
+		if isDrowsy && (!sameSession || !prevDrowsy || ts.Sub(prevTime) > reportEpisodeGap) {
+			acc.addEpisode(ts)
+		}
+
+		prevSession, prevTime, prevDrowsy = sessionID, ts, isDrowsy
+	}
+	flushPrev(time.Time{}, false)
+	return rows.Err()
+}
+
+// GetTrends отдаёт дневную или недельную динамику усталости пользователя
+// и распределение сонливости по часам суток.
+// GET /api/reports/trends?period=day|week&from=2024-01-01&to=2024-01-31&tz=Europe/Moscow[&user_id=2]
+func GetTrends(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	viewerID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	period := q.Get("period")
+	if period == "" {
+		period = "day"
+	}
+	if period != "day" && period != "week" {
+		http.Error(w, "Period must be day or week", http.StatusBadRequest)
+		return
+	}
+
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+		loc = l
+	}
+
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	userID, ok := resolveTargetUser(ctx, w, r, viewerID)
+	if !ok {
+		return
+	}
+
+	// Выравниваем диапазон по границам интервалов и добавляем перед ним
+	// такой же по длине предыдущий период для сравнения
+	start := bucketStart(from, period, loc)
+	end := bucketStart(to, period, loc)
+	if end.Before(to) {
+		end = nextBucket(end, period)
+	}
+	n := 0
+	for t := start; t.Before(end); t = nextBucket(t, period) {
+		n++
+	}
+	if n > 400 {
+		http.Error(w, "Range is too large", http.StatusBadRequest)
+		return
+	}
+	prevStart := start
+	for i := 0; i < n; i++ {
+		if period == "week" {
+			prevStart = prevStart.AddDate(0, 0, -7)
+		} else {
+			prevStart = prevStart.AddDate(0, 0, -1)
+		}
+	}
+
+	acc := newTrendAccumulator(prevStart, end, period, loc, start)
+	if err := acc.loadSessions(ctx, userID, prevStart, end); err != nil {
+		log.Printf("Trends: failed to load sessions: %v", err)
+		http.Error(w, "Failed to build trends", http.StatusInternalServerError)
+		return
+	}
+	if err := acc.loadEvents(ctx, userID, prevStart, end, excludeFalsePositives(r)); err != nil {
+		log.Printf("Trends: failed to load events: %v", err)
+		http.Error(w, "Failed to build trends", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range acc.buckets {
+		acc.buckets[i].Sessions = len(acc.sessions[i])
+		finalizeBucket(&acc.buckets[i])
+	}
+	for h := range acc.timeOfDay {
+		acc.timeOfDay[h].DrowsyMinutes = roundTo(acc.timeOfDay[h].DrowsyMinutes, 2)
+	}
+
+	previous := sumBuckets(acc.buckets[:n], acc.sessions[:n])
+	summary := sumBuckets(acc.buckets[n:], acc.sessions[n:])
+	finalizeBucket(&previous)
+	finalizeBucket(&summary)
+	summary.Trend = compareTrend(summary, previous)
+
+	buckets := acc.buckets[n:]
+	for i := range buckets {
+		buckets[i].Trend = compareTrend(buckets[i], acc.buckets[n+i-1])
+	}
+
+	json.NewEncoder(w).Encode(models.TrendReport{
+		UserID:    userID,
+		Period:    period,
+		Timezone:  loc.String(),
+		From:      start,
+		To:        end,
+		Buckets:   buckets,
+		Summary:   summary,
+		Previous:  previous,
+		TimeOfDay: acc.timeOfDay,
+	})
+}
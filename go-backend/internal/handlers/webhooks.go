@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"AI_DETECTOR/go-backend/internal/database"
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/internal/services"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var webhookEventTypes = map[string]bool{
+	models.WebhookAlertStart:     true,
+	models.WebhookAlertEnd:       true,
+	models.WebhookSessionEnd:     true,
+	models.WebhookAlertEscalated: true,
+}
+
+// Адрес webhook: http(s) и не заведомо внутренний хост. Имена, указывающие во внутреннюю сеть,
+// отсекаются уже при доставке
+func validateWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if services.IsForbiddenTargetHost(u.Hostname()) {
+		return false
+	}
+	return u.Scheme == "https" || u.Scheme == "http"
+}
+
+// Проверяет право управлять webhook: свой webhook пользователя
+// или webhook организации, которой actor управляет. При отказе сам пишет ответ
+func authorizeWebhook(ctx context.Context, w http.ResponseWriter, actorID, webhookID int) bool {
+	var orgID, userID sql.NullInt64
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT organization_id, user_id FROM webhooks WHERE id = $1", webhookID,
+	).Scan(&orgID, &userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		log.Printf("Failed to fetch webhook: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if userID.Valid && int(userID.Int64) == actorID {
+		return true
+	}
+	if orgID.Valid {
+		allowed, err := canManageOrganization(ctx, actorID, int(orgID.Int64))
+		if err != nil {
+			log.Printf("Failed to check webhook access: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return false
+		}
+		if allowed {
+			return true
+		}
+	}
+	http.Error(w, "Webhook not found", http.StatusNotFound)
+	return false
+}
+
+// Webhooks: список доступных webhook и регистрация нового.
+// Секрет для проверки подписи возвращается только при создании.
+// GET /api/webhooks
+// POST /api/webhooks {"url": "https://...", "events": ["alert.start", "alert.end", "session.end"], "organization_id": 1}
+func Webhooks(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		listWebhooks(ctx, w, userID)
+	case http.MethodPost:
+		createWebhook(ctx, w, r, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listWebhooks(ctx context.Context, w http.ResponseWriter, userID int) {
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT wh.id, wh.organization_id, wh.user_id, wh.url, wh.events, wh.active, wh.created_at
+		FROM webhooks wh JOIN users u ON u.id = $1
+		WHERE wh.user_id = u.id OR u.role = $2 OR (u.role = $3 AND wh.organization_id = u.organization_id)
+		ORDER BY wh.id`,
+		userID, models.RoleAdmin, models.RoleManager,
+	)
+	if err != nil {
+		log.Printf("Failed to fetch webhooks: %v", err)
+		http.Error(w, "Failed to fetch webhooks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var wh models.Webhook
+		var orgID, ownerID sql.NullInt64
+		var events string
+		if err := rows.Scan(&wh.ID, &orgID, &ownerID, &wh.URL, &events, &wh.Active, &wh.CreatedAt); err != nil {
+			continue
+		}
+		if orgID.Valid {
+			id := int(orgID.Int64)
+			wh.OrganizationID = &id
+		}
+		if ownerID.Valid {
+			id := int(ownerID.Int64)
+			wh.UserID = &id
+		}
+		wh.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, wh)
+	}
+
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func createWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int) {
+	var req models.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if !validateWebhookURL(req.URL) {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) == 0 {
+		http.Error(w, "At least one event type is required", http.StatusBadRequest)
+		return
+	}
+	for _, e := range req.Events {
+		if !webhookEventTypes[e] {
+			http.Error(w, "Unknown event type: "+e, http.StatusBadRequest)
+			return
+		}
+	}
+
+	wh := models.Webhook{URL: req.URL, Events: req.Events, Active: true}
+	if req.OrganizationID != nil {
+		allowed, err := canManageOrganization(ctx, userID, *req.OrganizationID)
+		if err != nil {
+			log.Printf("Failed to check webhook access: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Forbidden: manager or admin role required", http.StatusForbidden)
+			return
+		}
+		wh.OrganizationID = req.OrganizationID
+	} else {
+		wh.UserID = &userID
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("Failed to generate webhook secret: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	wh.Secret = hex.EncodeToString(secret)
+
+	err := database.DB.QueryRowContext(ctx,
+		`INSERT INTO webhooks (organization_id, user_id, url, secret, events, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		wh.OrganizationID, wh.UserID, wh.URL, wh.Secret, strings.Join(wh.Events, ","), userID,
+	).Scan(&wh.ID, &wh.CreatedAt)
+	if err != nil {
+		log.Printf("Failed to create webhook: %v", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Webhook %d created by user %d", wh.ID, userID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(wh)
+}
+
+// DeleteWebhook удаляет webhook вместе с очередью и журналом доставок.
+// DELETE /api/webhooks/delete?id=1
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	webhookID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if !authorizeWebhook(ctx, w, userID, webhookID) {
+		return
+	}
+
+	if _, err := database.DB.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", webhookID); err != nil {
+		log.Printf("Failed to delete webhook: %v", err)
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Webhook deleted"))
+	log.Printf("Webhook %d deleted by user %d", webhookID, userID)
+}
+
+// WebhookDeliveries возвращает последние доставки webhook с журналом попыток.
+// GET /api/webhooks/deliveries?webhook_id=1[&status=failed][&limit=50]
+func WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, exists := GetUserIDFromCookie(r)
+	if !exists {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	webhookID, err := strconv.Atoi(q.Get("webhook_id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if !authorizeWebhook(ctx, w, userID, webhookID) {
+		return
+	}
+
+	query := `SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+		last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries WHERE webhook_id = $1`
+	args := []interface{}{webhookID, limit}
+	if status := q.Get("status"); status != "" {
+		query += " AND status = $3"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT $2"
+
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("Failed to fetch webhook deliveries: %v", err)
+		http.Error(w, "Failed to fetch deliveries", http.StatusInternalServerError)
+		return
+	}
+	deliveries := []models.WebhookDelivery{}
+	index := make(map[int64]int)
+	var ids []int64
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload []byte
+		var code sql.NullInt64
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&code, &d.LastError, &d.CreatedAt, &deliveredAt); err != nil {
+			continue
+		}
+		d.Payload = payload
+		if code.Valid {
+			c := int(code.Int64)
+			d.LastStatusCode = &c
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		d.Log = []models.WebhookAttempt{}
+		index[d.ID] = len(deliveries)
+		ids = append(ids, d.ID)
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+
+	if len(ids) > 0 {
+		rows, err := database.DB.QueryContext(ctx,
+			`SELECT delivery_id, attempted_at, status_code, error, duration_ms
+			FROM webhook_delivery_attempts WHERE delivery_id = ANY($1) ORDER BY attempted_at, id`,
+			ids,
+		)
+		if err != nil {
+			log.Printf("Failed to fetch webhook attempts: %v", err)
+			http.Error(w, "Failed to fetch deliveries", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var deliveryID int64
+			var a models.WebhookAttempt
+			var code sql.NullInt64
+			if err := rows.Scan(&deliveryID, &a.AttemptedAt, &code, &a.Error, &a.DurationMs); err != nil {
+				continue
+			}
+			if code.Valid {
+				c := int(code.Int64)
+				a.StatusCode = &c
+			}
+			i := index[deliveryID]
+			deliveries[i].Log = append(deliveries[i].Log, a)
+		}
+	}
+
+	json.NewEncoder(w).Encode(deliveries)
+}
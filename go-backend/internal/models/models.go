@@ -1,6 +1,16 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// Роли пользователей
+const (
+	RoleDriver  = "driver"
+	RoleManager = "manager"
+	RoleAdmin   = "admin"
+)
 
 type User struct {
 	ID           int       `json:"id"`
@@ -17,6 +27,28 @@ type Session struct {
 	EndTime   *time.Time `json:"end_time,omitempty"`
 	Status    string     `json:"status"`
 	Notes     string     `json:"notes,omitempty"`
+	VehicleID string     `json:"vehicle_id,omitempty"`
+	State     string     `json:"state,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Состояние сеанса; тревоги можно подавлять, пока сеанс не в движении
+const (
+	SessionStateDriving     = "driving"
+	SessionStateParking     = "parking"
+	SessionStateLoading     = "loading"
+	SessionStateCalibration = "calibration"
+)
+
+// Активный сеанс с текущими счётчиками
+type CurrentSession struct {
+	Session
+	EventsCount int        `json:"events_count"`
+	DrowsyCount int        `json:"drowsy_count"`
+	AvgScore    float64    `json:"avg_score"`
+	LastScore   *float64   `json:"last_score,omitempty"`
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+	DurationSec int64      `json:"duration_sec"`
 }
 
 type Event struct {
@@ -25,6 +57,345 @@ type Event struct {
 	DrowsinessScore float64   `json:"drowsiness_score"`
 	IsDrowsy        bool      `json:"is_drowsy"`
 	Timestamp       time.Time `json:"timestamp"`
+	Perclos         *float64  `json:"perclos,omitempty"`
+	BlinkRate       *float64  `json:"blink_rate,omitempty"`
+	LongBlinks      *int      `json:"long_blinks,omitempty"`
+}
+
+// Скользящие метрики глаз за окно: доля времени с закрытыми глазами (PERCLOS, 0..1),
+// моргания в минуту и число долгих морганий
+type EyeMetrics struct {
+	Perclos    float64 `json:"perclos"`
+	BlinkRate  float64 `json:"blink_rate"`
+	Blinks     int     `json:"blinks"`
+	LongBlinks int     `json:"long_blinks"`
+	WindowSec  float64 `json:"window_sec"`
+}
+
+// Метки разметки событий
+const (
+	LabelTruePositive  = "true_positive"
+	LabelFalsePositive = "false_positive"
+	LabelUnknown       = "unknown"
+)
+
+type Annotation struct {
+	ID        int        `json:"id"`
+	SessionID int        `json:"session_id"`
+	EventID   *int       `json:"event_id,omitempty"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Label     string     `json:"label"`
+	Comment   string     `json:"comment,omitempty"`
+	AuthorID  *int       `json:"author_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Серьёзность эпизода тревоги
+const (
+	AlertSeverityLow    = "low"
+	AlertSeverityMedium = "medium"
+	AlertSeverityHigh   = "high"
+)
+
+// Типы тревоги
+const (
+	AlertTypeDrowsiness  = "DROWSINESS"
+	AlertTypeDistraction = "DISTRACTION"
+)
+
+// Причины тревоги об отвлечении
+const (
+	DistractionGaze     = "gaze"
+	DistractionHeadDown = "head_down"
+)
+
+// Стабильные коды статуса обработки кадра и уровня тревоги в REST/WebSocket
+const (
+	DetectionStatusOK     = "ok"
+	DetectionStatusNoFace = "no_face"
+	DetectionStatusNoEyes = "no_eyes"
+	DetectionStatusError  = "error"
+
+	AlertLevelAwake   = "awake"
+	AlertLevelDrowsy  = "drowsy"
+	AlertLevelUnknown = "unknown"
+)
+
+type DetectionCode struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}
+
+// Справочник кодов с подписями на выбранном языке
+type DetectionCodes struct {
+	Language string          `json:"language"`
+	Statuses []DetectionCode `json:"statuses"`
+	Levels   []DetectionCode `json:"levels"`
+}
+
+// Эпизод тревоги: непрерывный период сонливости или отвлечения, выделенный сервером
+type AlertEpisode struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	AlertType       string     `json:"alert_type"`
+	Reason          string     `json:"reason,omitempty"`
+	SessionID       *int       `json:"session_id,omitempty"`
+	ClientID        string     `json:"client_id,omitempty"`
+	StartTime       time.Time  `json:"start_time"`
+	EndTime         *time.Time `json:"end_time,omitempty"`
+	PeakScore       float64    `json:"peak_score"`
+	Severity        string     `json:"severity"`
+	Frames          int        `json:"frames"`
+	AcknowledgedAt  *time.Time `json:"acknowledged_at,omitempty"`
+	AckLatencyMs    *int64     `json:"ack_latency_ms,omitempty"`
+	EscalationLevel int        `json:"escalation_level"`
+}
+
+// Шаги цепочки эскалации неподтверждённой тревоги
+const (
+	EscalationRepeat    = "repeat"
+	EscalationManager   = "manager"
+	EscalationEmergency = "emergency"
+)
+
+// Событие эскалации: уровень начинается с 1 для первого шага цепочки
+type AlertEscalationEvent struct {
+	Episode    AlertEpisode `json:"episode"`
+	Level      int          `json:"level"`
+	Action     string       `json:"action"`
+	ElapsedSec float64      `json:"elapsed_sec"`
+}
+
+type EmergencyContact struct {
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Channel   string    `json:"channel"`
+	Target    string    `json:"target"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Сводка по подтверждениям тревог за период
+type AlertAckStats struct {
+	Episodes         int      `json:"episodes"`
+	Acknowledged     int      `json:"acknowledged"`
+	Escalated        int      `json:"escalated"`
+	ReachedManager   int      `json:"reached_manager"`
+	ReachedEmergency int      `json:"reached_emergency"`
+	AvgLatencyMs     *float64 `json:"avg_latency_ms,omitempty"`
+	MedianLatencyMs  *float64 `json:"median_latency_ms,omitempty"`
+	P90LatencyMs     *float64 `json:"p90_latency_ms,omitempty"`
+}
+
+// Источник действующих настроек тревоги
+const (
+	AlertSettingsUser         = "user"
+	AlertSettingsOrganization = "organization"
+	AlertSettingsDefault      = "default"
+)
+
+// Методы сглаживания покадровой оценки сонливости
+const (
+	SmoothingNone   = "none"
+	SmoothingEMA    = "ema"
+	SmoothingMedian = "median"
+)
+
+// Настройки тревоги: порог оценки, минимальная длительность, пауза между тревогами
+// и сглаживание оценки с гистерезисом
+type AlertSettings struct {
+	OrganizationID  *int       `json:"organization_id,omitempty"`
+	UserID          *int       `json:"user_id,omitempty"`
+	ScoreThreshold  float64    `json:"score_threshold"`
+	MinDurationMs   int        `json:"min_duration_ms"`
+	CooldownSec     int        `json:"cooldown_sec"`
+	SmoothingMethod string     `json:"smoothing_method"`
+	SmoothingAlpha  float64    `json:"smoothing_alpha"`
+	SmoothingWindow int        `json:"smoothing_window"`
+	Hysteresis      float64    `json:"hysteresis"`
+	Source          string     `json:"source,omitempty"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+}
+
+// Типы событий webhook
+const (
+	WebhookAlertStart = "alert.start"
+	WebhookAlertEnd   = "alert.end"
+	WebhookSessionEnd = "session.end"
+	// Тревога не подтверждена и передана менеджеру
+	WebhookAlertEscalated = "alert.escalated"
+	// Сообщение экстренному контакту; только прямая отправка, без подписок
+	NotificationAlertEmergency = "alert.emergency"
+)
+
+// Статусы доставки webhook
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID             int       `json:"id"`
+	OrganizationID *int      `json:"organization_id,omitempty"`
+	UserID         *int      `json:"user_id,omitempty"`
+	URL            string    `json:"url"`
+	Events         []string  `json:"events"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+	// Показывается только при создании
+	Secret string `json:"secret,omitempty"`
+}
+
+// Тело запроса, которое получает webhook
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	UserID    int         `json:"user_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  *int      `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int       `json:"duration_ms"`
+}
+
+type WebhookDelivery struct {
+	ID             int64            `json:"id"`
+	WebhookID      int              `json:"webhook_id"`
+	EventType      string           `json:"event_type"`
+	Payload        json.RawMessage  `json:"payload"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  time.Time        `json:"next_attempt_at"`
+	LastStatusCode *int             `json:"last_status_code,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`
+	Log            []WebhookAttempt `json:"log"`
+}
+
+// Каналы уведомлений
+const (
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+	ChannelChatBot = "chatbot"
+)
+
+type NotificationSubscription struct {
+	ID                  int       `json:"id"`
+	SubscriberID        int       `json:"subscriber_id"`
+	Channel             string    `json:"channel"`
+	Target              string    `json:"target"`
+	Events              []string  `json:"events"`
+	WatchUserID         *int      `json:"watch_user_id,omitempty"`
+	WatchOrganizationID *int      `json:"watch_organization_id,omitempty"`
+	SubjectTemplate     string    `json:"subject_template,omitempty"`
+	BodyTemplate        string    `json:"body_template,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+type NotificationLogEntry struct {
+	ID             int64     `json:"id"`
+	SubscriptionID int       `json:"subscription_id"`
+	Event          string    `json:"event"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Ссылка для просмотра сеанса без учётной записи
+type SessionShare struct {
+	ID          int        `json:"id"`
+	SessionID   int        `json:"session_id"`
+	CreatedBy   int        `json:"created_by"`
+	Label       string     `json:"label,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	AccessCount int        `json:"access_count"`
+	LastAccess  *time.Time `json:"last_access,omitempty"`
+}
+
+type ShareAccess struct {
+	ID         int64     `json:"id"`
+	ShareID    int       `json:"share_id"`
+	Resource   string    `json:"resource"`
+	Result     string    `json:"result"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+// Сводка сеанса для просмотра по ссылке
+type SessionSummary struct {
+	Session
+	EventsCount int     `json:"events_count"`
+	DrowsyCount int     `json:"drowsy_count"`
+	Episodes    int     `json:"episodes"`
+	AvgScore    float64 `json:"avg_score"`
+	MaxScore    float64 `json:"max_score"`
+	DurationSec int64   `json:"duration_sec"`
+}
+
+type RetentionPolicy struct {
+	ID             int       `json:"id"`
+	OrganizationID *int      `json:"organization_id,omitempty"`
+	UserID         *int      `json:"user_id,omitempty"`
+	RetentionDays  int       `json:"retention_days"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type EventArchive struct {
+	ID            int        `json:"id"`
+	UserID        *int       `json:"user_id,omitempty"`
+	FilePath      string     `json:"file_path"`
+	Cutoff        time.Time  `json:"cutoff"`
+	SessionsCount int        `json:"sessions_count"`
+	EventsCount   int        `json:"events_count"`
+	SizeBytes     int64      `json:"size_bytes"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RestoredAt    *time.Time `json:"restored_at,omitempty"`
+}
+
+// Отчёт о динамике усталости по дням или неделям
+type TrendChange struct {
+	DrowsyMinutesPct      *float64 `json:"drowsy_minutes_change_pct"`
+	EpisodesPerHourChange float64  `json:"episodes_per_hour_change"`
+	Direction             string   `json:"direction"`
+}
+
+type TrendBucket struct {
+	Start           time.Time    `json:"start"`
+	End             time.Time    `json:"end"`
+	Sessions        int          `json:"sessions"`
+	HoursMonitored  float64      `json:"hours_monitored"`
+	DrowsyMinutes   float64      `json:"drowsy_minutes"`
+	Episodes        int          `json:"episodes"`
+	EpisodesPerHour float64      `json:"episodes_per_hour"`
+	Trend           *TrendChange `json:"trend,omitempty"`
+}
+
+type TimeOfDayBucket struct {
+	Hour          int     `json:"hour"`
+	DrowsyMinutes float64 `json:"drowsy_minutes"`
+	Episodes      int     `json:"episodes"`
+}
+
+type TrendReport struct {
+	UserID    int               `json:"user_id"`
+	Period    string            `json:"period"`
+	Timezone  string            `json:"timezone"`
+	From      time.Time         `json:"from"`
+	To        time.Time         `json:"to"`
+	Buckets   []TrendBucket     `json:"buckets"`
+	Summary   TrendBucket       `json:"summary"`
+	Previous  TrendBucket       `json:"previous"`
+	TimeOfDay []TimeOfDayBucket `json:"time_of_day"`
 }
 
 type RegisterRequest struct {
@@ -39,17 +410,179 @@ type LoginRequest struct {
 }
 
 type CreateSessionRequest struct {
-	Notes string `json:"notes"`
+	Notes     string `json:"notes"`
+	VehicleID string `json:"vehicle_id"`
+}
+
+type SessionStateRequest struct {
+	State string `json:"state"`
+}
+
+// Виды правил подавления тревог
+const (
+	SuppressionWindow       = "window"
+	SuppressionDaily        = "daily"
+	SuppressionSessionState = "session_state"
+)
+
+// Правило подавления тревог для пользователя или транспортного средства
+type SuppressionRule struct {
+	ID        int     `json:"id"`
+	UserID    *int    `json:"user_id,omitempty"`
+	VehicleID *string `json:"vehicle_id,omitempty"`
+	// Организация правила транспортного средства
+	OrganizationID *int       `json:"organization_id,omitempty"`
+	Kind           string     `json:"kind"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	DailyStart     string     `json:"daily_start,omitempty"`
+	DailyEnd       string     `json:"daily_end,omitempty"`
+	Timezone       string     `json:"timezone,omitempty"`
+	States         []string   `json:"states,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+	Source         string     `json:"source"`
+	CreatedBy      *int       `json:"created_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type SuppressionRuleRequest struct {
+	UserID    *int    `json:"user_id"`
+	VehicleID *string `json:"vehicle_id"`
+	// Только для администратора; менеджер создаёт правила транспорта своей организации
+	OrganizationID *int       `json:"organization_id"`
+	Kind           string     `json:"kind"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	DailyStart     string     `json:"daily_start"`
+	DailyEnd       string     `json:"daily_end"`
+	Timezone       string     `json:"timezone"`
+	States         []string   `json:"states"`
+	Reason         string     `json:"reason"`
+}
+
+// Тревога, подавленная правилом
+type SuppressedAlert struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	SessionID *int       `json:"session_id,omitempty"`
+	RuleID    *int       `json:"rule_id,omitempty"`
+	AlertType string     `json:"alert_type"`
+	Reason    string     `json:"reason"`
+	ClientID  string     `json:"client_id,omitempty"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	PeakScore float64    `json:"peak_score"`
+	Severity  string     `json:"severity"`
+	Frames    int        `json:"frames"`
+}
+
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+// organization_id = null убирает пользователя из организации
+type UserRoleRequest struct {
+	UserID         int    `json:"user_id"`
+	Role           string `json:"role"`
+	OrganizationID *int   `json:"organization_id"`
+}
+
+type RetentionPolicyRequest struct {
+	OrganizationID *int `json:"organization_id"`
+	UserID         *int `json:"user_id"`
+	RetentionDays  int  `json:"retention_days"`
+}
+
+type CreateWebhookRequest struct {
+	OrganizationID *int     `json:"organization_id"`
+	URL            string   `json:"url"`
+	Events         []string `json:"events"`
+}
+
+type CreateSubscriptionRequest struct {
+	Channel             string   `json:"channel"`
+	Target              string   `json:"target"`
+	Events              []string `json:"events"`
+	WatchUserID         *int     `json:"watch_user_id"`
+	WatchOrganizationID *int     `json:"watch_organization_id"`
+	SubjectTemplate     string   `json:"subject_template"`
+	BodyTemplate        string   `json:"body_template"`
+}
+
+// Не заданные параметры сглаживания и гистерезис берутся из настроек по умолчанию
+type AlertSettingsRequest struct {
+	OrganizationID  *int     `json:"organization_id"`
+	UserID          *int     `json:"user_id"`
+	ScoreThreshold  float64  `json:"score_threshold"`
+	MinDurationMs   int      `json:"min_duration_ms"`
+	CooldownSec     int      `json:"cooldown_sec"`
+	SmoothingMethod string   `json:"smoothing_method"`
+	SmoothingAlpha  float64  `json:"smoothing_alpha"`
+	SmoothingWindow int      `json:"smoothing_window"`
+	Hysteresis      *float64 `json:"hysteresis"`
+}
+
+type CreateAnnotationRequest struct {
+	SessionID int        `json:"session_id"`
+	EventID   *int       `json:"event_id"`
+	StartTime *time.Time `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"`
+	Label     string     `json:"label"`
+	Comment   string     `json:"comment"`
+}
+
+type CreateShareRequest struct {
+	SessionID      int    `json:"session_id"`
+	ExpiresInHours int    `json:"expires_in_hours"`
+	Label          string `json:"label"`
+}
+
+type CreateShareResponse struct {
+	Share SessionShare `json:"share"`
+	Token string       `json:"token"`
+}
+
+// Массовые операции с сеансами: удаление и восстановление
+type BulkSessionsRequest struct {
+	IDs []int `json:"ids"`
+}
+
+type BulkSessionsResponse struct {
+	Processed []int `json:"processed"`
+	NotFound  []int `json:"not_found"`
+}
+
+type TrashedSession struct {
+	Session
+	PurgeAt time.Time `json:"purge_at"`
 }
 
 type CreateEventRequest struct {
-	SessionID       int     `json:"session_id"`
-	DrowsinessScore float64 `json:"drowsiness_score"`
-	IsDrowsy        bool    `json:"is_drowsy"`
+	SessionID       int      `json:"session_id"`
+	DrowsinessScore float64  `json:"drowsiness_score"`
+	IsDrowsy        bool     `json:"is_drowsy"`
+	Perclos         *float64 `json:"perclos"`
+	BlinkRate       *float64 `json:"blink_rate"`
+	LongBlinks      *int     `json:"long_blinks"`
 }
 
 type WSFrameMessage struct {
 	Frame          string `json:"frame"`
 	Timestamp      int64  `json:"timestamp"`
 	SequenceNumber int32  `json:"sequence_number"`
+	StreamID       uint16 `json:"stream_id,omitempty"`
+}
+
+// Запись NDJSON-выгрузки: сеанс, событие или разметка
+type ExportRecord struct {
+	Type       string      `json:"type"`
+	Session    *Session    `json:"session,omitempty"`
+	Event      *Event      `json:"event,omitempty"`
+	Annotation *Annotation `json:"annotation,omitempty"`
 }
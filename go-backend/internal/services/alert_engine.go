@@ -0,0 +1,105 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/pkg/pb"
+	"time"
+)
+
+// Переходы состояния тревоги
+const (
+	AlertStarted = "start"
+	AlertEnded   = "end"
+)
+
+// Пороги серьёзности эпизода по пиковой оценке
+const (
+	alertSeverityHighScore   = 0.85
+	alertSeverityMediumScore = 0.7
+)
+
+type AlertEngineConfig struct {
+	// Минимальная пауза после окончания эпизода до начала следующего
+	Cooldown time.Duration
+}
+
+type AlertTransition struct {
+	Type    string
+	Episode *models.AlertEpisode
+}
+
+// AlertEngine превращает поток покадровых результатов одного клиента в эпизоды тревоги.
+// Решение о сонливости принимает DrowsinessClassifier (сглаживание, порог, гистерезис и
+// минимальная длительность): эпизод идёт, пока кадры помечены is_drowsy, поэтому
+// ALERT_START и is_drowsy в DETECTION_RESULT не расходятся.
+// Не потокобезопасен: вызывается из обработчика кадров клиента
+type AlertEngine struct {
+	cfg     AlertEngineConfig
+	current *models.AlertEpisode
+	lastEnd time.Time
+}
+
+func NewAlertEngine(cfg AlertEngineConfig) *AlertEngine {
+	return &AlertEngine{cfg: cfg}
+}
+
+func alertSeverity(peak float64) string {
+	switch {
+	case peak >= alertSeverityHighScore:
+		return models.AlertSeverityHigh
+	case peak >= alertSeverityMediumScore:
+		return models.AlertSeverityMedium
+	default:
+		return models.AlertSeverityLow
+	}
+}
+
+// Process учитывает очередной результат, уже обработанный DrowsinessClassifier.Apply,
+// и возвращает переход, если он произошёл
+func (e *AlertEngine) Process(result *pb.DetectionResult, at time.Time) *AlertTransition {
+	score := float64(result.GetDrowsinessScore())
+	drowsy := detectionOK(result) && result.IsDrowsy
+
+	if e.current == nil {
+		if !drowsy {
+			return nil
+		}
+		if !e.lastEnd.IsZero() && at.Sub(e.lastEnd) < e.cfg.Cooldown {
+			return nil
+		}
+		e.current = &models.AlertEpisode{
+			AlertType: models.AlertTypeDrowsiness,
+			StartTime: at,
+			PeakScore: score,
+			Severity:  alertSeverity(score),
+			Frames:    1,
+		}
+		return &AlertTransition{Type: AlertStarted, Episode: e.current}
+	}
+
+	if !drowsy {
+		return e.end(at)
+	}
+	e.current.Frames++
+	if score > e.current.PeakScore {
+		e.current.PeakScore = score
+		e.current.Severity = alertSeverity(score)
+	}
+	return nil
+}
+
+// Flush закрывает открытый эпизод, например при отключении клиента
+func (e *AlertEngine) Flush(at time.Time) *AlertTransition {
+	if e.current == nil {
+		return nil
+	}
+	return e.end(at)
+}
+
+func (e *AlertEngine) end(at time.Time) *AlertTransition {
+	ep := e.current
+	ep.EndTime = &at
+	e.current = nil
+	e.lastEnd = at
+	return &AlertTransition{Type: AlertEnded, Episode: ep}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"context"
+	"database/sql"
+)
+
+// AlertStore сохраняет эпизоды тревоги: строка создаётся при начале эпизода
+// и дополняется при его окончании, чтобы незавершённые эпизоды тоже были видны
+type AlertStore struct {
+	db *sql.DB
+}
+
+func NewAlertStore(db *sql.DB) *AlertStore {
+	return &AlertStore{db: db}
+}
+
+// Open сохраняет начавшийся эпизод. Эпизод относится к сеансу, только если к нему
+// привязано подключение; иначе session_id остаётся пустым
+func (s *AlertStore) Open(ctx context.Context, ep *models.AlertEpisode) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO alert_episodes (user_id, session_id, client_id, start_time, peak_score, severity, frames, alert_type, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		ep.UserID, ep.SessionID, ep.ClientID, ep.StartTime, ep.PeakScore, ep.Severity, ep.Frames, ep.AlertType, ep.Reason,
+	).Scan(&ep.ID)
+}
+
+func (s *AlertStore) Close(ctx context.Context, ep *models.AlertEpisode) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE alert_episodes SET end_time = $1, peak_score = $2, severity = $3, frames = $4, reason = $5 WHERE id = $6",
+		ep.EndTime, ep.PeakScore, ep.Severity, ep.Frames, ep.Reason, ep.ID,
+	)
+	return err
+}
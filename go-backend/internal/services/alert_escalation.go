@@ -0,0 +1,201 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Шаг цепочки эскалации: действие выполняется через After после начала тревоги
+type EscalationStep struct {
+	Action string
+	After  time.Duration
+}
+
+// ParseEscalationChain разбирает цепочку вида "repeat:15s,manager:45s,emergency:2m".
+// Пустая строка отключает эскалацию
+func ParseEscalationChain(spec string) ([]EscalationStep, error) {
+	var steps []EscalationStep
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		action, after, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("escalation step %q: expected action:duration", part)
+		}
+		switch action {
+		case models.EscalationRepeat, models.EscalationManager, models.EscalationEmergency:
+		default:
+			return nil, fmt.Errorf("escalation step %q: unknown action %q", part, action)
+		}
+		d, err := time.ParseDuration(after)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("escalation step %q: invalid duration", part)
+		}
+		if n := len(steps); n > 0 && d <= steps[n-1].After {
+			return nil, fmt.Errorf("escalation step %q: delays must increase", part)
+		}
+		steps = append(steps, EscalationStep{Action: action, After: d})
+	}
+	return steps, nil
+}
+
+// Результат подтверждения тревоги
+type AlertAck struct {
+	Episode models.AlertEpisode
+	Latency time.Duration
+	Level   int
+}
+
+// AlertEscalation ведёт эскалацию тревог одного клиента: пока эпизод не подтверждён
+// и не закончился, по таймерам выполняются шаги цепочки. fire вызывается из горутины таймера
+type AlertEscalation struct {
+	steps []EscalationStep
+	fire  func(evt models.AlertEscalationEvent)
+
+	mu      sync.Mutex
+	episode *models.AlertEpisode // последний эпизод, подтвердить можно и после его окончания
+	acked   bool
+	active  bool
+	level   int
+	timer   *time.Timer
+	gen     int
+}
+
+func NewAlertEscalation(steps []EscalationStep, fire func(evt models.AlertEscalationEvent)) *AlertEscalation {
+	return &AlertEscalation{steps: steps, fire: fire}
+}
+
+// Start начинает эскалацию эпизода; предыдущий эпизод больше нельзя подтвердить
+func (e *AlertEscalation) Start(ep models.AlertEpisode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.stopTimer()
+	e.episode = &ep
+	e.acked = false
+	e.active = true
+	e.level = 0
+	e.schedule()
+}
+
+// Stop прекращает эскалацию, когда эпизод закончился или клиент отключился
+func (e *AlertEscalation) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.active = false
+	e.stopTimer()
+}
+
+// Ack подтверждает последний эпизод (episodeID = 0) или эпизод с указанным ID
+func (e *AlertEscalation) Ack(episodeID int, at time.Time) (*AlertAck, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.episode == nil || (episodeID != 0 && e.episode.ID != episodeID) {
+		return nil, fmt.Errorf("no alert to acknowledge")
+	}
+	if e.acked {
+		return nil, fmt.Errorf("alert already acknowledged")
+	}
+	e.acked = true
+	e.active = false
+	e.stopTimer()
+
+	latency := max(at.Sub(e.episode.StartTime), 0)
+	return &AlertAck{Episode: *e.episode, Latency: latency, Level: e.level}, nil
+}
+
+func (e *AlertEscalation) stopTimer() {
+	e.gen++
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+}
+
+// Ставит таймер следующего шага; вызывается под e.mu
+func (e *AlertEscalation) schedule() {
+	if !e.active || e.level >= len(e.steps) {
+		return
+	}
+	gen := e.gen
+	step := e.steps[e.level]
+	delay := time.Until(e.episode.StartTime.Add(step.After))
+	e.timer = time.AfterFunc(max(delay, 0), func() { e.advance(gen) })
+}
+
+func (e *AlertEscalation) advance(gen int) {
+	e.mu.Lock()
+	// Таймер мог сработать одновременно с подтверждением или новой тревогой
+	if gen != e.gen || !e.active {
+		e.mu.Unlock()
+		return
+	}
+	step := e.steps[e.level]
+	e.level++
+	evt := models.AlertEscalationEvent{
+		Episode:    *e.episode,
+		Level:      e.level,
+		Action:     step.Action,
+		ElapsedSec: time.Since(e.episode.StartTime).Seconds(),
+	}
+	evt.Episode.EscalationLevel = e.level
+	e.schedule()
+	e.mu.Unlock()
+
+	e.fire(evt)
+}
+
+// RecordEscalation сохраняет шаг эскалации и повышает достигнутый уровень эпизода
+func (s *AlertStore) RecordEscalation(ctx context.Context, episodeID, level int, action string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO alert_escalations (episode_id, level, action) VALUES ($1, $2, $3)",
+		episodeID, level, action,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE alert_episodes SET escalation_level = GREATEST(escalation_level, $1) WHERE id = $2",
+		level, episodeID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Acknowledge сохраняет время подтверждения и задержку реакции водителя
+func (s *AlertStore) Acknowledge(ctx context.Context, episodeID int, at time.Time, latency time.Duration) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE alert_episodes SET acknowledged_at = $1, ack_latency_ms = $2 WHERE id = $3 AND acknowledged_at IS NULL",
+		at, latency.Milliseconds(), episodeID,
+	)
+	return err
+}
+
+// LoadEmergencyContact возвращает экстренный контакт пользователя или nil, если он не задан
+func LoadEmergencyContact(ctx context.Context, db *sql.DB, userID int) (*models.EmergencyContact, error) {
+	var c models.EmergencyContact
+	err := db.QueryRowContext(ctx,
+		"SELECT user_id, name, channel, target, updated_at FROM emergency_contacts WHERE user_id = $1", userID,
+	).Scan(&c.UserID, &c.Name, &c.Channel, &c.Target, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
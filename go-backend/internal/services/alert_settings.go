@@ -0,0 +1,102 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/pkg/pb"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ResolveAlertSettings возвращает действующие настройки пользователя:
+// собственные, иначе организации, иначе defaults
+func ResolveAlertSettings(ctx context.Context, db *sql.DB, userID int, defaults models.AlertSettings) (models.AlertSettings, error) {
+	settings := defaults
+	settings.UserID = &userID
+	settings.Source = models.AlertSettingsDefault
+
+	var ownUser bool
+	var updatedAt time.Time
+	err := db.QueryRowContext(ctx,
+		`SELECT a.score_threshold, a.min_duration_ms, a.cooldown_sec,
+			a.smoothing_method, a.smoothing_alpha, a.smoothing_window, a.hysteresis, a.user_id IS NOT NULL, a.updated_at
+		FROM alert_settings a JOIN users u ON u.id = $1
+		WHERE a.user_id = u.id OR a.organization_id = u.organization_id
+		ORDER BY (a.user_id IS NULL) LIMIT 1`,
+		userID,
+	).Scan(&settings.ScoreThreshold, &settings.MinDurationMs, &settings.CooldownSec,
+		&settings.SmoothingMethod, &settings.SmoothingAlpha, &settings.SmoothingWindow, &settings.Hysteresis,
+		&ownUser, &updatedAt)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	} else if err != nil {
+		return defaults, err
+	}
+
+	settings.Source = models.AlertSettingsOrganization
+	if ownUser {
+		settings.Source = models.AlertSettingsUser
+	}
+	settings.UpdatedAt = &updatedAt
+	return settings, nil
+}
+
+// AlertEngineConfigFor строит конфигурацию движка эпизодов из настроек пользователя.
+// Порог, гистерезис и минимальную длительность применяет DrowsinessClassifier
+func AlertEngineConfigFor(settings models.AlertSettings) AlertEngineConfig {
+	return AlertEngineConfig{
+		Cooldown: time.Duration(settings.CooldownSec) * time.Second,
+	}
+}
+
+// DrowsinessClassifier заново принимает покадровое решение is_drowsy/alert_level
+// по сглаженной оценке с порогом пользователя вместо порога Python-сервиса.
+// Оценка выше порога считается, пока не опустится ниже threshold - hysteresis;
+// кадр считается сонным, только если это состояние держится не меньше MinDuration.
+// Не потокобезопасен: вызывается из обработчика кадров клиента
+type DrowsinessClassifier struct {
+	smoother    *ScoreSmoother
+	threshold   float64
+	hysteresis  float64
+	minDuration int64 // мс
+	aboveSince  int64
+	above       bool
+}
+
+func NewDrowsinessClassifier(settings models.AlertSettings) *DrowsinessClassifier {
+	return &DrowsinessClassifier{
+		smoother:    NewScoreSmoother(settings.SmoothingMethod, settings.SmoothingAlpha, settings.SmoothingWindow),
+		threshold:   settings.ScoreThreshold,
+		hysteresis:  settings.Hysteresis,
+		minDuration: int64(settings.MinDurationMs),
+	}
+}
+
+// Apply меняет IsDrowsy и AlertLevel результата и возвращает сглаженную оценку.
+// Служебные состояния (ошибка, нет лица, нет глаз) оставляются как есть,
+// в сглаживание не попадают, и для них возвращается сырая оценка
+func (c *DrowsinessClassifier) Apply(result *pb.DetectionResult, now time.Time) float64 {
+	if !detectionOK(result) {
+		c.above = false
+		return float64(result.DrowsinessScore)
+	}
+
+	at := frameTimeMs(result, now)
+	score := c.smoother.Smooth(float64(result.DrowsinessScore))
+	switch {
+	case c.above && score < c.threshold-c.hysteresis:
+		c.above = false
+	case !c.above && score >= c.threshold:
+		c.above = true
+		c.aboveSince = at
+	}
+
+	result.IsDrowsy = c.above && at-c.aboveSince >= c.minDuration
+	if result.IsDrowsy {
+		result.Level = pb.AlertLevel_ALERT_LEVEL_DROWSY
+	} else {
+		result.Level = pb.AlertLevel_ALERT_LEVEL_AWAKE
+	}
+	result.AlertLevel = legacyAlertLevel(result)
+	return score
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/pkg/pb"
+	"testing"
+	"time"
+)
+
+func TestDrowsinessClassifierApply(t *testing.T) {
+	type frame struct {
+		atMs   int64
+		score  float32
+		status pb.DetectionStatus
+		drowsy bool
+	}
+	ok := pb.DetectionStatus_DETECTION_STATUS_OK
+	settings := models.AlertSettings{
+		ScoreThreshold:  0.6,
+		Hysteresis:      0.1,
+		MinDurationMs:   1000,
+		SmoothingMethod: models.SmoothingNone,
+	}
+
+	tests := []struct {
+		name   string
+		frames []frame
+	}{
+		{
+			name: "below threshold stays awake",
+			frames: []frame{
+				{0, 0.5, ok, false},
+				{1000, 0.59, ok, false},
+			},
+		},
+		{
+			name: "min duration not reached",
+			frames: []frame{
+				{0, 0.7, ok, false},
+				{500, 0.7, ok, false},
+				{999, 0.7, ok, false},
+				{1200, 0.4, ok, false},
+			},
+		},
+		{
+			name: "min duration reached",
+			frames: []frame{
+				{0, 0.7, ok, false},
+				{1000, 0.7, ok, true},
+				{1500, 0.8, ok, true},
+			},
+		},
+		{
+			name: "score inside hysteresis band keeps state",
+			frames: []frame{
+				{0, 0.7, ok, false},
+				{1000, 0.55, ok, true},
+				{1500, 0.5, ok, true},
+				{2000, 0.49, ok, false},
+			},
+		},
+		{
+			name: "hysteresis band does not start an alert",
+			frames: []frame{
+				{0, 0.55, ok, false},
+				{2000, 0.55, ok, false},
+			},
+		},
+		{
+			name: "dropping out restarts min duration",
+			frames: []frame{
+				{0, 0.7, ok, false},
+				{800, 0.4, ok, false},
+				{900, 0.7, ok, false},
+				{1800, 0.7, ok, false},
+				{1900, 0.7, ok, true},
+			},
+		},
+		{
+			name: "service status resets the state",
+			frames: []frame{
+				{0, 0.7, ok, false},
+				{1000, 0.7, ok, true},
+				{1100, 0.7, pb.DetectionStatus_DETECTION_STATUS_NO_FACE, false},
+				{1200, 0.7, ok, false},
+				{2200, 0.7, ok, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewDrowsinessClassifier(settings)
+			for i, f := range tt.frames {
+				result := &pb.DetectionResult{DrowsinessScore: f.score, ClientTimestamp: f.atMs + 1, Status: f.status}
+				c.Apply(result, time.Time{})
+				if result.IsDrowsy != f.drowsy {
+					t.Fatalf("frame %d (%d ms, %.2f): is_drowsy = %v, want %v", i, f.atMs, f.score, result.IsDrowsy, f.drowsy)
+				}
+				if f.status != ok {
+					continue
+				}
+				wantLevel := pb.AlertLevel_ALERT_LEVEL_AWAKE
+				if f.drowsy {
+					wantLevel = pb.AlertLevel_ALERT_LEVEL_DROWSY
+				}
+				if result.Level != wantLevel {
+					t.Fatalf("frame %d: level = %v, want %v", i, result.Level, wantLevel)
+				}
+			}
+		})
+	}
+}
+
+func TestDrowsinessClassifierSmoothsScore(t *testing.T) {
+	c := NewDrowsinessClassifier(models.AlertSettings{
+		ScoreThreshold:  0.6,
+		SmoothingMethod: models.SmoothingMedian,
+		SmoothingWindow: 3,
+	})
+	ok := pb.DetectionStatus_DETECTION_STATUS_OK
+	// Одиночный выброс гасится медианой и тревогу не включает
+	for i, score := range []float32{0.1, 0.1, 0.95, 0.1} {
+		result := &pb.DetectionResult{DrowsinessScore: score, ClientTimestamp: int64(i+1) * 100, Status: ok}
+		if smoothed := c.Apply(result, time.Time{}); smoothed >= 0.6 || result.IsDrowsy {
+			t.Fatalf("frame %d: smoothed %v, is_drowsy %v", i, smoothed, result.IsDrowsy)
+		}
+	}
+}
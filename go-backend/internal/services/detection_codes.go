@@ -0,0 +1,156 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/pkg/pb"
+	"strings"
+)
+
+// Значения alert_level от Python-сервиса. Новые клиенты должны использовать status и level,
+// строки остаются для старых клиентов и сервисов, которые ещё не заполняют перечисления
+const (
+	alertLevelError        = "error"
+	alertLevelNoFace       = "ЛИЦО НЕ ОБНАРУЖЕНО"
+	alertLevelNoEyes       = "ГЛАЗА НЕ ОБНАРУЖЕНЫ"
+	alertLevelNotEnoughEye = "НЕДОСТАТОЧНО ГЛАЗ"
+	alertLevelDrowsy       = "СОНЛИВОСТЬ"
+	alertLevelAwake        = "БОДРСТВОВАНИЕ"
+)
+
+var legacyDetectionStatus = map[string]pb.DetectionStatus{
+	alertLevelError:        pb.DetectionStatus_DETECTION_STATUS_ERROR,
+	alertLevelNoFace:       pb.DetectionStatus_DETECTION_STATUS_NO_FACE,
+	alertLevelNoEyes:       pb.DetectionStatus_DETECTION_STATUS_NO_EYES,
+	alertLevelNotEnoughEye: pb.DetectionStatus_DETECTION_STATUS_NO_EYES,
+	alertLevelDrowsy:       pb.DetectionStatus_DETECTION_STATUS_OK,
+	alertLevelAwake:        pb.DetectionStatus_DETECTION_STATUS_OK,
+}
+
+// NormalizeDetection заполняет status и level по alert_level, если сервис прислал
+// только строку, и наоборот - строку для старых клиентов по перечислениям
+func NormalizeDetection(result *pb.DetectionResult) {
+	if result.Status == pb.DetectionStatus_DETECTION_STATUS_UNSPECIFIED {
+		status, ok := legacyDetectionStatus[result.AlertLevel]
+		if !ok {
+			status = pb.DetectionStatus_DETECTION_STATUS_ERROR
+		}
+		result.Status = status
+	}
+	if result.Level == pb.AlertLevel_ALERT_LEVEL_UNSPECIFIED && result.Status == pb.DetectionStatus_DETECTION_STATUS_OK {
+		result.Level = pb.AlertLevel_ALERT_LEVEL_AWAKE
+		if result.IsDrowsy {
+			result.Level = pb.AlertLevel_ALERT_LEVEL_DROWSY
+		}
+	}
+	if result.AlertLevel == "" {
+		result.AlertLevel = legacyAlertLevel(result)
+	}
+}
+
+func legacyAlertLevel(result *pb.DetectionResult) string {
+	switch result.Status {
+	case pb.DetectionStatus_DETECTION_STATUS_NO_FACE:
+		return alertLevelNoFace
+	case pb.DetectionStatus_DETECTION_STATUS_NO_EYES:
+		return alertLevelNoEyes
+	case pb.DetectionStatus_DETECTION_STATUS_OK:
+		if result.Level == pb.AlertLevel_ALERT_LEVEL_DROWSY {
+			return alertLevelDrowsy
+		}
+		return alertLevelAwake
+	}
+	return alertLevelError
+}
+
+// Кадр с распознанным лицом и глазами, по которому можно судить о сонливости
+func detectionOK(result *pb.DetectionResult) bool {
+	return result.GetStatus() == pb.DetectionStatus_DETECTION_STATUS_OK
+}
+
+// DetectionStatusCode возвращает стабильный код статуса для REST/WebSocket
+func DetectionStatusCode(status pb.DetectionStatus) string {
+	switch status {
+	case pb.DetectionStatus_DETECTION_STATUS_OK:
+		return models.DetectionStatusOK
+	case pb.DetectionStatus_DETECTION_STATUS_NO_FACE:
+		return models.DetectionStatusNoFace
+	case pb.DetectionStatus_DETECTION_STATUS_NO_EYES:
+		return models.DetectionStatusNoEyes
+	}
+	return models.DetectionStatusError
+}
+
+// AlertLevelCode возвращает стабильный код уровня тревоги для REST/WebSocket
+func AlertLevelCode(level pb.AlertLevel) string {
+	switch level {
+	case pb.AlertLevel_ALERT_LEVEL_AWAKE:
+		return models.AlertLevelAwake
+	case pb.AlertLevel_ALERT_LEVEL_DROWSY:
+		return models.AlertLevelDrowsy
+	}
+	return models.AlertLevelUnknown
+}
+
+// Подписи кодов статуса и уровня тревоги по языкам; первый язык - по умолчанию
+var (
+	detectionLanguages = []string{"ru", "en"}
+	detectionLabels    = map[string]map[string]string{
+		"ru": {
+			models.DetectionStatusOK:     "Лицо распознано",
+			models.DetectionStatusNoFace: "Лицо не обнаружено",
+			models.DetectionStatusNoEyes: "Глаза не обнаружены",
+			models.DetectionStatusError:  "Ошибка обработки",
+			models.AlertLevelAwake:       "Бодрствование",
+			models.AlertLevelDrowsy:      "Сонливость",
+			models.AlertLevelUnknown:     "Нет данных",
+		},
+		"en": {
+			models.DetectionStatusOK:     "Face detected",
+			models.DetectionStatusNoFace: "No face detected",
+			models.DetectionStatusNoEyes: "Eyes not detected",
+			models.DetectionStatusError:  "Processing error",
+			models.AlertLevelAwake:       "Awake",
+			models.AlertLevelDrowsy:      "Drowsy",
+			models.AlertLevelUnknown:     "No data",
+		},
+	}
+)
+
+// DetectionLanguage выбирает язык подписей: явно заданный lang, иначе первый
+// поддерживаемый из заголовка Accept-Language, иначе язык по умолчанию
+func DetectionLanguage(lang, acceptLanguage string) string {
+	candidates := []string{lang}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		candidates = append(candidates, tag)
+	}
+	for _, c := range candidates {
+		base, _, _ := strings.Cut(strings.ToLower(c), "-")
+		if _, ok := detectionLabels[base]; ok {
+			return base
+		}
+	}
+	return detectionLanguages[0]
+}
+
+// DetectionLabel возвращает подпись кода на языке lang
+func DetectionLabel(code, lang string) string {
+	if labels, ok := detectionLabels[lang]; ok {
+		return labels[code]
+	}
+	return detectionLabels[detectionLanguages[0]][code]
+}
+
+// DetectionCodes возвращает все коды статуса и уровня тревоги с подписями на языке lang
+func DetectionCodes(lang string) models.DetectionCodes {
+	var codes models.DetectionCodes
+	codes.Language = lang
+	for _, code := range []string{models.DetectionStatusOK, models.DetectionStatusNoFace,
+		models.DetectionStatusNoEyes, models.DetectionStatusError} {
+		codes.Statuses = append(codes.Statuses, models.DetectionCode{Code: code, Label: DetectionLabel(code, lang)})
+	}
+	for _, code := range []string{models.AlertLevelAwake, models.AlertLevelDrowsy, models.AlertLevelUnknown} {
+		codes.Levels = append(codes.Levels, models.DetectionCode{Code: code, Label: DetectionLabel(code, lang)})
+	}
+	return codes
+}
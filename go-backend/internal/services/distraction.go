@@ -0,0 +1,155 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/pkg/pb"
+	"math"
+	"time"
+)
+
+type DistractionConfig struct {
+	// Сколько взгляд должен быть отведён от дороги, прежде чем откроется эпизод
+	LookAway time.Duration
+	// Сколько голова должна быть опущена не меньше HeadDownAngle градусов
+	HeadDown      time.Duration
+	HeadDownAngle float64
+	// Сколько внимание должно вернуться, прежде чем эпизод закроется
+	Recovery time.Duration
+}
+
+// DistractionAnalyzer выделяет эпизоды отвлечения: взгляд в сторону или опущенная голова,
+// которые держатся дольше заданного времени. Сонливые кадры отвлечением не считаются -
+// их обрабатывает AlertEngine. Не потокобезопасен: вызывается из обработчика кадров клиента
+type DistractionAnalyzer struct {
+	cfg     DistractionConfig
+	current *models.AlertEpisode
+
+	awaySince     time.Time
+	headDownSince time.Time
+	attentiveFrom time.Time
+}
+
+func NewDistractionAnalyzer(cfg DistractionConfig) *DistractionAnalyzer {
+	return &DistractionAnalyzer{cfg: cfg}
+}
+
+// Серьёзность по длительности отвлечения относительно порога
+func distractionSeverity(elapsed, threshold time.Duration) string {
+	switch {
+	case elapsed >= 3*threshold:
+		return models.AlertSeverityHigh
+	case elapsed >= 2*threshold:
+		return models.AlertSeverityMedium
+	default:
+		return models.AlertSeverityLow
+	}
+}
+
+// Process учитывает очередной результат и возвращает переход, если он произошёл.
+// Ожидает результат после NormalizeDetection и DrowsinessClassifier, чтобы is_drowsy учитывал порог пользователя
+func (d *DistractionAnalyzer) Process(result *pb.DetectionResult, at time.Time) *AlertTransition {
+	status := result.GetStatus()
+	if status == pb.DetectionStatus_DETECTION_STATUS_ERROR {
+		return nil
+	}
+
+	// Отсутствие лица в кадре обычно значит, что водитель отвернулся
+	noFace := status == pb.DetectionStatus_DETECTION_STATUS_NO_FACE
+	away := noFace || (!result.GetEyesLookingForward() && !result.GetIsDrowsy())
+	angle := float64(result.GetHeadAngle())
+	headDown := !noFace && d.cfg.HeadDownAngle > 0 && angle >= d.cfg.HeadDownAngle
+
+	if away {
+		if d.awaySince.IsZero() {
+			d.awaySince = at
+		}
+	} else {
+		d.awaySince = time.Time{}
+	}
+	if headDown {
+		if d.headDownSince.IsZero() {
+			d.headDownSince = at
+		}
+	} else {
+		d.headDownSince = time.Time{}
+	}
+
+	if d.current == nil {
+		reason, since, threshold := d.triggered(at)
+		if reason == "" {
+			return nil
+		}
+		d.current = &models.AlertEpisode{
+			AlertType: models.AlertTypeDistraction,
+			Reason:    reason,
+			StartTime: since,
+			Severity:  distractionSeverity(at.Sub(since), threshold),
+			Frames:    1,
+		}
+		d.updatePeak(result, reason)
+		return &AlertTransition{Type: AlertStarted, Episode: d.current}
+	}
+
+	d.current.Frames++
+	if away || headDown {
+		d.attentiveFrom = time.Time{}
+		if headDown && !away {
+			d.current.Reason = models.DistractionHeadDown
+		}
+		d.updatePeak(result, d.current.Reason)
+		threshold := d.cfg.LookAway
+		if d.current.Reason == models.DistractionHeadDown {
+			threshold = d.cfg.HeadDown
+		}
+		d.current.Severity = distractionSeverity(at.Sub(d.current.StartTime), threshold)
+		return nil
+	}
+
+	if d.attentiveFrom.IsZero() {
+		d.attentiveFrom = at
+	}
+	if at.Sub(d.attentiveFrom) < d.cfg.Recovery {
+		return nil
+	}
+	return d.end(d.attentiveFrom)
+}
+
+// Причина, начало и порог условия, продержавшегося дольше порога; опущенная голова важнее
+func (d *DistractionAnalyzer) triggered(at time.Time) (string, time.Time, time.Duration) {
+	if !d.headDownSince.IsZero() && at.Sub(d.headDownSince) >= d.cfg.HeadDown {
+		return models.DistractionHeadDown, d.headDownSince, d.cfg.HeadDown
+	}
+	if !d.awaySince.IsZero() && at.Sub(d.awaySince) >= d.cfg.LookAway {
+		return models.DistractionGaze, d.awaySince, d.cfg.LookAway
+	}
+	return "", time.Time{}, 0
+}
+
+// Пиковая оценка: отклонение взгляда или наклон головы, приведённый к [0, 1]
+func (d *DistractionAnalyzer) updatePeak(result *pb.DetectionResult, reason string) {
+	score := float64(result.GetEyeDirectionScore())
+	if reason == models.DistractionHeadDown {
+		score = math.Min(float64(result.GetHeadAngle())/90, 1)
+	}
+	if score > d.current.PeakScore {
+		d.current.PeakScore = score
+	}
+}
+
+// Flush закрывает открытый эпизод, например при отключении клиента
+func (d *DistractionAnalyzer) Flush(at time.Time) *AlertTransition {
+	if d.current == nil {
+		return nil
+	}
+	return d.end(at)
+}
+
+func (d *DistractionAnalyzer) end(at time.Time) *AlertTransition {
+	ep := d.current
+	ep.EndTime = &at
+	d.current = nil
+	d.awaySince = time.Time{}
+	d.headDownSince = time.Time{}
+	d.attentiveFrom = time.Time{}
+	return &AlertTransition{Type: AlertEnded, Episode: ep}
+}
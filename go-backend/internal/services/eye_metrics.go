@@ -0,0 +1,168 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"AI_DETECTOR/go-backend/pkg/pb"
+	"time"
+)
+
+// Дольше этого промежуток между кадрами не засчитывается кадру целиком,
+// чтобы пропуск кадров или пауза клиента не раздували PERCLOS
+const eyeMaxFrameGap = time.Second
+
+type EyeMetricsConfig struct {
+	// Окно, за которое считаются PERCLOS и частота морганий
+	Window time.Duration
+	// Кадр считается кадром с закрытыми глазами при оценке не ниже порога
+	ClosedThreshold float64
+	// Закрытие глаз дольше этого считается долгим морганием, короче - обычным
+	LongBlink time.Duration
+}
+
+type eyeSample struct {
+	at       int64 // мс
+	duration int64 // мс, известна после следующего кадра
+	closed   bool
+	valid    bool
+}
+
+type blinkRecord struct {
+	end  int64
+	long bool
+}
+
+// EyeMetricsAnalyzer считает скользящие PERCLOS, частоту морганий и долгие моргания
+// по покадровым результатам одного клиента. Время кадра берётся из client_timestamp,
+// кадры с неубывающим sequence_number отбрасываются как повторы.
+// Не потокобезопасен: вызывается из обработчика кадров клиента
+type EyeMetricsAnalyzer struct {
+	cfg EyeMetricsConfig
+
+	samples  []eyeSample
+	closedMs int64
+	validMs  int64
+
+	blinks       []blinkRecord
+	closureStart int64
+	inClosure    bool
+
+	lastSeq int32
+	metrics models.EyeMetrics
+}
+
+func NewEyeMetricsAnalyzer(cfg EyeMetricsConfig) *EyeMetricsAnalyzer {
+	return &EyeMetricsAnalyzer{cfg: cfg}
+}
+
+func frameTimeMs(result *pb.DetectionResult, now time.Time) int64 {
+	if ts := result.GetClientTimestamp(); ts > 0 {
+		return ts
+	}
+	return now.UnixMilli()
+}
+
+// Process учитывает кадр и возвращает метрики на текущий момент
+func (a *EyeMetricsAnalyzer) Process(result *pb.DetectionResult, now time.Time) models.EyeMetrics {
+	seq := result.GetSequenceNumber()
+	if seq != 0 && a.lastSeq != 0 && seq <= a.lastSeq {
+		return a.metrics
+	}
+	a.lastSeq = seq
+
+	at := frameTimeMs(result, now)
+	status := result.GetStatus()
+	valid := status != pb.DetectionStatus_DETECTION_STATUS_ERROR && status != pb.DetectionStatus_DETECTION_STATUS_NO_FACE
+	closed := valid && float64(result.GetDrowsinessScore()) >= a.cfg.ClosedThreshold
+
+	// Длительность предыдущего кадра - до текущего
+	if n := len(a.samples); n > 0 {
+		prev := &a.samples[n-1]
+		if at < prev.at {
+			// Часы клиента пошли назад: начинаем окно заново
+			a.reset()
+		} else {
+			prev.duration = min(at-prev.at, eyeMaxFrameGap.Milliseconds())
+			if prev.valid {
+				a.validMs += prev.duration
+			}
+			if prev.closed {
+				a.closedMs += prev.duration
+			}
+		}
+	}
+
+	a.trackBlink(at, closed, valid)
+	a.samples = append(a.samples, eyeSample{at: at, closed: closed, valid: valid})
+	a.evict(at)
+
+	a.metrics = a.compute(at)
+	return a.metrics
+}
+
+func (a *EyeMetricsAnalyzer) trackBlink(at int64, closed, valid bool) {
+	switch {
+	case !valid:
+		// Лицо потеряно: незавершённое закрытие не считаем морганием
+		a.inClosure = false
+	case closed && !a.inClosure:
+		a.inClosure = true
+		a.closureStart = at
+	case !closed && a.inClosure:
+		a.inClosure = false
+		a.blinks = append(a.blinks, blinkRecord{
+			end:  at,
+			long: at-a.closureStart >= a.cfg.LongBlink.Milliseconds(),
+		})
+	}
+}
+
+func (a *EyeMetricsAnalyzer) evict(at int64) {
+	from := at - a.cfg.Window.Milliseconds()
+
+	i := 0
+	for i < len(a.samples)-1 && a.samples[i].at < from {
+		s := a.samples[i]
+		if s.valid {
+			a.validMs -= s.duration
+		}
+		if s.closed {
+			a.closedMs -= s.duration
+		}
+		i++
+	}
+	a.samples = a.samples[i:]
+
+	j := 0
+	for j < len(a.blinks) && a.blinks[j].end < from {
+		j++
+	}
+	a.blinks = a.blinks[j:]
+}
+
+func (a *EyeMetricsAnalyzer) compute(at int64) models.EyeMetrics {
+	m := models.EyeMetrics{}
+	if a.validMs > 0 {
+		m.Perclos = float64(a.closedMs) / float64(a.validMs)
+	}
+	for _, b := range a.blinks {
+		if b.long {
+			m.LongBlinks++
+		} else {
+			m.Blinks++
+		}
+	}
+	// Пока окно не заполнено, частоту считаем по фактически накопленному времени
+	span := min(at-a.samples[0].at, a.cfg.Window.Milliseconds())
+	if span > 0 {
+		m.BlinkRate = float64(m.Blinks+m.LongBlinks) * 60000 / float64(span)
+	}
+	m.WindowSec = float64(span) / 1000
+	return m
+}
+
+func (a *EyeMetricsAnalyzer) reset() {
+	a.samples = a.samples[:0]
+	a.blinks = a.blinks[:0]
+	a.closedMs, a.validMs = 0, 0
+	a.inClosure = false
+}
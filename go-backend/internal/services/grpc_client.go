@@ -85,6 +85,7 @@ func (gc *GRPCClient) ProcessFrame(ctx context.Context, frame *pb.VideoFrame) (*
 		log.Printf("ProcessFrame error: %v (connection state: %s)", err, gc.conn.GetState().String())
 		return nil, fmt.Errorf("could not detect drowsiness: %w", err)
 	}
+	NormalizeDetection(result)
 	return result, nil
 }
 
@@ -16,6 +16,8 @@ type Metrics struct {
 	wsConnections atomic.Int64
 	wsMessages    atomic.Int64
 	wsErrors      atomic.Int64
+	// Кадры, отброшенные очередями клиентов как устаревшие
+	droppedFrames atomic.Int64
 }
 
 var (
@@ -103,6 +105,14 @@ func (m *Metrics) GetWebSocketErrors() int64 {
 	return m.wsErrors.Load()
 }
 
+func (m *Metrics) IncrementDroppedFrames(n int) {
+	m.droppedFrames.Add(int64(n))
+}
+
+func (m *Metrics) GetDroppedFrames() int64 {
+	return m.droppedFrames.Load()
+}
+
 func (m *Metrics) GetWebSocketMetrics() map[string]interface{} {
 	return map[string]interface{}{
 		"connections": m.wsConnections.Load(),
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	notificationQueueSize = 256
+	// Одновременно отправляемых уведомлений по всем каналам; остальные ждут своей
+	// очереди в собственных горутинах, не задерживая разбор очереди событий
+	notificationMaxInFlight = 64
+	notificationAttempts    = 3
+	notificationRetryBase   = 2 * time.Second
+)
+
+// Данные, доступные в шаблонах уведомлений
+type NotificationData struct {
+	Event    string
+	UserID   int
+	Username string
+	Time     time.Time
+	// Данные события: models.AlertEpisode для тревог, models.AlertEscalationEvent
+	// для эскалации, map для session.end
+	Data interface{}
+}
+
+var notificationFuncs = template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.Local().Format("02.01.2006 15:04:05")
+	},
+}
+
+type notificationTemplate struct {
+	subject string
+	body    string
+}
+
+// Шаблоны по умолчанию; подписка может переопределить тему и текст
+var defaultNotificationTemplates = map[string]notificationTemplate{
+	models.WebhookAlertStart: {
+		subject: "Тревога: {{if eq .Data.AlertType \"DISTRACTION\"}}отвлечение{{else}}признаки сонливости{{end}} у {{.Username}}",
+		body: "Пользователь {{.Username}}: {{if eq .Data.AlertType \"DISTRACTION\"}}отвлечение от дороги ({{.Data.Reason}}){{else}}обнаружены признаки сонливости{{end}}.\n" +
+			"Начало: {{time .Data.StartTime}}\n" +
+			"Уровень: {{.Data.Severity}}, пиковая оценка {{printf \"%.2f\" .Data.PeakScore}}",
+	},
+	models.WebhookAlertEnd: {
+		subject: "Тревога завершена: {{.Username}}",
+		body: "Пользователь {{.Username}}: эпизод {{if eq .Data.AlertType \"DISTRACTION\"}}отвлечения{{else}}сонливости{{end}} завершён.\n" +
+			"Начало: {{time .Data.StartTime}}{{with .Data.EndTime}}, окончание: {{time .}}{{end}}\n" +
+			"Уровень: {{.Data.Severity}}, пиковая оценка {{printf \"%.2f\" .Data.PeakScore}}",
+	},
+	models.WebhookAlertEscalated: {
+		subject: "Тревога не подтверждена: {{.Username}}",
+		body: "Пользователь {{.Username}} не подтвердил тревогу в течение {{printf \"%.0f\" .Data.ElapsedSec}} с.\n" +
+			"Начало: {{time .Data.Episode.StartTime}}\n" +
+			"Уровень: {{.Data.Episode.Severity}}, пиковая оценка {{printf \"%.2f\" .Data.Episode.PeakScore}}",
+	},
+	models.NotificationAlertEmergency: {
+		subject: "СРОЧНО: {{.Username}} не отвечает на тревогу",
+		body: "Пользователь {{.Username}} не реагирует на сигнал о сонливости уже {{printf \"%.0f\" .Data.ElapsedSec}} с.\n" +
+			"Начало тревоги: {{time .Data.Episode.StartTime}}, уровень: {{.Data.Episode.Severity}}.\n" +
+			"Пожалуйста, свяжитесь с водителем.",
+	},
+	models.WebhookSessionEnd: {
+		subject: "Сеанс завершён: {{.Username}}",
+		body:    "Пользователь {{.Username}} завершил сеанс {{.Data.session_id}} в {{time .Data.end_time}}.",
+	},
+}
+
+// Ограничения пользовательских шаблонов: длина текста шаблона и размер результата
+const (
+	notificationTemplateMaxLen = 2000
+	notificationRenderMaxLen   = 8 << 10
+)
+
+var errNotificationTooLong = errors.New("rendered notification exceeds size limit")
+
+// ParseNotificationTemplate проверяет пользовательский шаблон при создании подписки
+func ParseNotificationTemplate(text string) error {
+	_, err := parseNotificationTemplate(text)
+	return err
+}
+
+// Разбирает шаблон и запрещает циклы и вызовы шаблонов: шаблон задаёт любой
+// пользователь, и {{range}} по числу позволяет получить сколь угодно большой текст
+func parseNotificationTemplate(text string) (*template.Template, error) {
+	if len(text) > notificationTemplateMaxLen {
+		return nil, fmt.Errorf("template is longer than %d bytes", notificationTemplateMaxLen)
+	}
+	tmpl, err := template.New("").Funcs(notificationFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, errors.New("define and block are not allowed in templates")
+	}
+	if tmpl.Tree != nil {
+		if err := checkTemplateNode(tmpl.Tree.Root); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+func checkTemplateNode(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkTemplateNode(child); err != nil {
+				return err
+			}
+		}
+	case *parse.RangeNode:
+		return errors.New("range is not allowed in templates")
+	case *parse.TemplateNode:
+		return errors.New("template is not allowed in templates")
+	case *parse.IfNode:
+		return checkTemplateBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkTemplateBranch(&n.BranchNode)
+	}
+	return nil
+}
+
+func checkTemplateBranch(n *parse.BranchNode) error {
+	if err := checkTemplateNode(n.List); err != nil {
+		return err
+	}
+	return checkTemplateNode(n.ElseList)
+}
+
+// Буфер, который прерывает выполнение шаблона, как только результат превышает limit
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if l.buf.Len()+len(p) > l.limit {
+		return 0, errNotificationTooLong
+	}
+	return l.buf.Write(p)
+}
+
+func renderTemplate(text string, data NotificationData) (string, error) {
+	tmpl, err := parseNotificationTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	out := &limitedBuffer{limit: notificationRenderMaxLen}
+	if err := tmpl.Execute(out, data); err != nil {
+		return "", err
+	}
+	return out.buf.String(), nil
+}
+
+// RenderNotification собирает сообщение по шаблонам подписки, а при их отсутствии - по шаблонам по умолчанию
+func RenderNotification(subjectTmpl, bodyTmpl string, data NotificationData) (Message, error) {
+	def := defaultNotificationTemplates[data.Event]
+	if subjectTmpl == "" {
+		subjectTmpl = def.subject
+	}
+	if bodyTmpl == "" {
+		bodyTmpl = def.body
+	}
+	msg := Message{Event: data.Event, Data: data.Data}
+	var err error
+	if msg.Subject, err = renderTemplate(subjectTmpl, data); err != nil {
+		return msg, err
+	}
+	if msg.Body, err = renderTemplate(bodyTmpl, data); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
+
+type notificationJob struct {
+	userID int
+	event  string
+	data   interface{}
+	at     time.Time
+}
+
+type notificationTarget struct {
+	id              int
+	channel         string
+	target          string
+	subjectTemplate string
+	bodyTemplate    string
+}
+
+// NotificationService рассылает уведомления по подпискам через зарегистрированные каналы.
+// Очередь в памяти: события не должны задерживать цикл обработки кадров. Очередь разбирают
+// workers обработчиков, которые только находят подписки и запускают доставку, не дожидаясь
+// её: медленный канал с повторами не задерживает следующие события
+type NotificationService struct {
+	db        *sql.DB
+	notifiers map[string]Notifier
+	queue     chan notificationJob
+	timeout   time.Duration
+	workers   int
+	inFlight  chan struct{}
+	delivery  sync.WaitGroup
+}
+
+func NewNotificationService(db *sql.DB, timeout time.Duration, workers int, notifiers ...Notifier) *NotificationService {
+	if workers < 1 {
+		workers = 1
+	}
+	ns := &NotificationService{
+		db:        db,
+		notifiers: make(map[string]Notifier),
+		queue:     make(chan notificationJob, notificationQueueSize),
+		timeout:   timeout,
+		workers:   workers,
+		inFlight:  make(chan struct{}, notificationMaxInFlight),
+	}
+	for _, n := range notifiers {
+		ns.notifiers[n.Channel()] = n
+	}
+	return ns
+}
+
+var (
+	notificationsMu       sync.RWMutex
+	notificationsInstance *NotificationService
+)
+
+// SetNotificationService задаёт сервис, через который PublishEvent рассылает уведомления
+func SetNotificationService(ns *NotificationService) {
+	notificationsMu.Lock()
+	notificationsInstance = ns
+	notificationsMu.Unlock()
+}
+
+func GetNotificationService() *NotificationService {
+	notificationsMu.RLock()
+	defer notificationsMu.RUnlock()
+	return notificationsInstance
+}
+
+// PublishEvent ставит событие пользователя в очередь webhook и рассылает уведомления подписчикам
+func PublishEvent(ctx context.Context, db *sql.DB, userID int, eventType string, data interface{}) error {
+	if ns := GetNotificationService(); ns != nil {
+		ns.Notify(userID, eventType, data)
+	}
+	return EnqueueWebhookEvent(ctx, db, userID, eventType, data)
+}
+
+// SendDirect отправляет уведомление по шаблону по умолчанию на адрес вне подписок
+// (например, экстренному контакту) синхронно, с повторами и без записи в журнал подписок
+func (ns *NotificationService) SendDirect(ctx context.Context, channel, target string, data NotificationData) error {
+	notifier, ok := ns.notifiers[channel]
+	if !ok {
+		return fmt.Errorf("channel %s is not configured on the server", channel)
+	}
+	msg, err := RenderNotification("", "", data)
+	if err != nil {
+		return err
+	}
+	_, err = ns.sendWithRetry(ctx, notifier, target, msg)
+	return err
+}
+
+// HasChannel сообщает, настроен ли канал на сервере
+func (ns *NotificationService) HasChannel(channel string) bool {
+	_, ok := ns.notifiers[channel]
+	return ok
+}
+
+func (ns *NotificationService) Channels() []string {
+	channels := make([]string, 0, len(ns.notifiers))
+	for _, c := range []string{models.ChannelWebhook, models.ChannelEmail, models.ChannelChatBot} {
+		if ns.HasChannel(c) {
+			channels = append(channels, c)
+		}
+	}
+	return channels
+}
+
+// Notify ставит событие в очередь рассылки не блокируясь; при переполнении событие отбрасывается
+func (ns *NotificationService) Notify(userID int, eventType string, data interface{}) {
+	select {
+	case ns.queue <- notificationJob{userID: userID, event: eventType, data: data, at: time.Now()}:
+	default:
+		log.Printf("Notification queue full, dropping %s for user %d", eventType, userID)
+	}
+}
+
+func (ns *NotificationService) Start(ctx context.Context) {
+	log.Printf("Notification service started: channels %v, %d workers", ns.Channels(), ns.workers)
+	var wg sync.WaitGroup
+	for i := 0; i < ns.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-ns.queue:
+					ns.dispatch(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// Прерванные остановкой доставки ещё записывают результат в журнал
+	ns.delivery.Wait()
+	log.Println("Notification service stopped")
+}
+
+// Подписки, получающие событие пользователя: на него самого, на его организацию
+// или собственные подписки пользователя. Подписчик должен по-прежнему иметь доступ к пользователю
+func (ns *NotificationService) targets(ctx context.Context, userID int, eventType string) ([]notificationTarget, error) {
+	rows, err := ns.db.QueryContext(ctx,
+		`SELECT s.id, s.channel, s.target, s.subject_template, s.body_template
+		FROM notification_subscriptions s
+		JOIN users u ON u.id = $1
+		JOIN users sub ON sub.id = s.subscriber_id
+		WHERE $2 = ANY(string_to_array(s.events, ','))
+		AND (s.watch_user_id = u.id OR s.watch_organization_id = u.organization_id
+			OR (s.watch_user_id IS NULL AND s.watch_organization_id IS NULL AND s.subscriber_id = u.id))
+		AND (sub.id = u.id OR sub.role = $3 OR (sub.role = $4 AND sub.organization_id = u.organization_id))`,
+		userID, eventType, models.RoleAdmin, models.RoleManager,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []notificationTarget
+	for rows.Next() {
+		var t notificationTarget
+		if err := rows.Scan(&t.id, &t.channel, &t.target, &t.subjectTemplate, &t.bodyTemplate); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+func (ns *NotificationService) dispatch(ctx context.Context, job notificationJob) {
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	targets, err := ns.targets(queryCtx, job.userID, job.event)
+	var username string
+	if err == nil && len(targets) > 0 {
+		err = ns.db.QueryRowContext(queryCtx, "SELECT username FROM users WHERE id = $1", job.userID).Scan(&username)
+	}
+	cancel()
+	if err != nil {
+		log.Printf("Failed to resolve notification subscriptions for user %d: %v", job.userID, err)
+		return
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	data := NotificationData{
+		Event:    job.event,
+		UserID:   job.userID,
+		Username: username,
+		Time:     job.at,
+		Data:     job.data,
+	}
+
+	// Каналы независимы: медленный SMTP не задерживает ни чат-бот, ни следующие события
+	for _, t := range targets {
+		ns.delivery.Add(1)
+		go func(t notificationTarget) {
+			defer ns.delivery.Done()
+			select {
+			case ns.inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-ns.inFlight }()
+			ns.deliver(ctx, t, data)
+		}(t)
+	}
+}
+
+func (ns *NotificationService) deliver(ctx context.Context, t notificationTarget, data NotificationData) {
+	attempts := 0
+	var sendErr error
+
+	notifier, ok := ns.notifiers[t.channel]
+	if !ok {
+		sendErr = fmt.Errorf("channel %s is not configured on the server", t.channel)
+	} else if msg, err := RenderNotification(t.subjectTemplate, t.bodyTemplate, data); err != nil {
+		sendErr = err
+	} else {
+		attempts, sendErr = ns.sendWithRetry(ctx, notifier, t.target, msg)
+	}
+
+	status, errText := "sent", ""
+	if sendErr != nil {
+		status, errText = "failed", sendErr.Error()
+		log.Printf("Notification %s via %s (subscription %d) failed: %v", data.Event, t.channel, t.id, sendErr)
+	}
+
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if _, err := ns.db.ExecContext(saveCtx,
+		"INSERT INTO notification_log (subscription_id, event, status, attempts, error) VALUES ($1, $2, $3, $4, $5)",
+		t.id, data.Event, status, attempts, errText,
+	); err != nil {
+		log.Printf("Failed to log notification for subscription %d: %v", t.id, err)
+	}
+}
+
+func (ns *NotificationService) sendWithRetry(ctx context.Context, notifier Notifier, target string, msg Message) (int, error) {
+	attempts := 0
+	var err error
+	for attempts < notificationAttempts {
+		if attempts > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(notificationRetryBase << (attempts - 1)):
+			}
+		}
+		if ctx.Err() != nil {
+			if err == nil {
+				err = ctx.Err()
+			}
+			break
+		}
+		attempts++
+		sendCtx, cancel := context.WithTimeout(ctx, ns.timeout)
+		err = notifier.Send(sendCtx, target, msg)
+		cancel()
+		if err == nil {
+			break
+		}
+	}
+	return attempts, err
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message - готовое к отправке уведомление
+type Message struct {
+	Event   string
+	Subject string
+	Body    string
+	// Исходные данные события, для каналов с машинным форматом (webhook)
+	Data interface{}
+}
+
+// Notifier отправляет уведомление в один канал. target - адрес получателя
+// в терминах канала: URL, email или идентификатор чата
+type Notifier interface {
+	Channel() string
+	Send(ctx context.Context, target string, msg Message) error
+}
+
+func checkResponse(resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyLimit))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return nil
+}
+
+// WebhookNotifier отправляет JSON с текстом и данными события на URL подписки.
+// При заданном секрете тело подписывается так же, как в WebhookDispatcher
+type WebhookNotifier struct {
+	client *http.Client
+	secret string
+}
+
+func NewWebhookNotifier(timeout time.Duration, secret string) *WebhookNotifier {
+	return &WebhookNotifier{client: newOutboundClient(timeout), secret: secret}
+}
+
+func (n *WebhookNotifier) Channel() string { return models.ChannelWebhook }
+
+func (n *WebhookNotifier) Send(ctx context.Context, target string, msg Message) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"event":   msg.Event,
+		"subject": msg.Subject,
+		"text":    msg.Body,
+		"data":    msg.Data,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AI-Detector-Notifier/1.0")
+	req.Header.Set("X-Webhook-Event", msg.Event)
+	if n.secret != "" {
+		ts := time.Now().Unix()
+		req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+		req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(n.secret, ts, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp)
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPNotifier отправляет письмо через SMTP, с STARTTLS, если сервер его поддерживает
+type SMTPNotifier struct {
+	cfg     SMTPConfig
+	timeout time.Duration
+}
+
+func NewSMTPNotifier(cfg SMTPConfig, timeout time.Duration) *SMTPNotifier {
+	return &SMTPNotifier{cfg: cfg, timeout: timeout}
+}
+
+func (n *SMTPNotifier) Channel() string { return models.ChannelEmail }
+
+func (n *SMTPNotifier) Send(ctx context.Context, target string, msg Message) error {
+	if strings.ContainsAny(target, "\r\n") {
+		return fmt.Errorf("invalid recipient address")
+	}
+
+	addr := net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port))
+	dialer := net.Dialer{Timeout: n.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// net/smtp не принимает контекст, поэтому ограничиваем весь обмен дедлайном соединения
+	deadline := time.Now().Add(n.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if n.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.cfg.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(target); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", target)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+
+	if _, err := wc.Write(buf.Bytes()); err != nil {
+		wc.Close()
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// ChatBotNotifier отправляет сообщение через HTTP API чат-бота в стиле Telegram:
+// POST {apiURL}/bot{token}/sendMessage {"chat_id": ..., "text": ...}.
+// apiURL можно направить на локальную заглушку
+type ChatBotNotifier struct {
+	client *http.Client
+	apiURL string
+	token  string
+}
+
+func NewChatBotNotifier(apiURL, token string, timeout time.Duration) *ChatBotNotifier {
+	return &ChatBotNotifier{
+		client: &http.Client{Timeout: timeout},
+		apiURL: strings.TrimRight(apiURL, "/"),
+		token:  token,
+	}
+}
+
+func (n *ChatBotNotifier) Channel() string { return models.ChannelChatBot }
+
+func (n *ChatBotNotifier) Send(ctx context.Context, target string, msg Message) error {
+	text := msg.Body
+	if msg.Subject != "" {
+		text = msg.Subject + "\n\n" + msg.Body
+	}
+	body, err := json.Marshal(map[string]string{
+		"chat_id": target,
+		"text":    text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		n.apiURL+"/bot"+n.token+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// Ошибка клиента содержит URL с токеном - не выносим его в журнал
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return fmt.Errorf("chat bot request failed: %w", err)
+	}
+	return checkResponse(resp)
+}
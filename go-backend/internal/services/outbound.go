@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget - адрес назначения webhook во внутренней сети
+var ErrForbiddenTarget = errors.New("target address is not allowed")
+
+// Разрешить webhook на внутренние адреса (WEBHOOK_ALLOW_PRIVATE_TARGETS), например для локальной разработки
+var allowPrivateTargets bool
+
+func SetAllowPrivateTargets(allow bool) {
+	allowPrivateTargets = allow
+}
+
+// Разделяемое адресное пространство провайдеров (RFC 6598), net.IP.IsPrivate его не включает
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || sharedAddressSpace.Contains(ip)
+}
+
+// IsForbiddenTargetHost сообщает, что хост URL заведомо указывает во внутреннюю сеть.
+// Имена проверяются только при соединении (см. newOutboundClient)
+func IsForbiddenTargetHost(host string) bool {
+	if allowPrivateTargets {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && forbiddenIP(ip)
+}
+
+// HTTP-клиент для адресов, заданных пользователями. Адрес проверяется при каждом соединении,
+// уже после разрешения имени: проверку URL обошла бы DNS-запись на внутренний адрес
+// или перенаправление
+func newOutboundClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivateTargets {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenTarget, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Через прокси соединение шло бы к прокси, и проверка адреса назначения не сработала бы
+	transport.Proxy = nil
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Сколько событий удаляется одним запросом после выгрузки
+const retentionDeleteChunk = 1000
+
+// RetentionService периодически удаляет старые события,
+// предварительно выгружая их в сжатые NDJSON-архивы на диске.
+// События, восстановленные из архива, повторно не архивируются
+type RetentionService struct {
+	db          *sql.DB
+	archiveDir  string
+	defaultDays int
+	interval    time.Duration
+}
+
+type RestoreReport struct {
+	SessionsRestored  int `json:"sessions_restored"`
+	SessionsRecreated int `json:"sessions_recreated"`
+	SessionsSkipped   int `json:"sessions_skipped"`
+	EventsRestored    int `json:"events_restored"`
+}
+
+// defaultDays - глобальный срок хранения, 0 отключает удаление
+// для пользователей без собственной политики
+func NewRetentionService(db *sql.DB, archiveDir string, defaultDays int, interval time.Duration) *RetentionService {
+	return &RetentionService{
+		db:          db,
+		archiveDir:  archiveDir,
+		defaultDays: defaultDays,
+		interval:    interval,
+	}
+}
+
+func (rs *RetentionService) Start(ctx context.Context) {
+	log.Printf("Retention job started: default %d days, every %v, archives in %s", rs.defaultDays, rs.interval, rs.archiveDir)
+
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := rs.RunOnce(ctx); err != nil {
+			log.Printf("Retention run failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("Retention job stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce применяет политики хранения ко всем пользователям.
+// Политика пользователя важнее политики организации, та - глобальной
+func (rs *RetentionService) RunOnce(ctx context.Context) error {
+	rows, err := rs.db.QueryContext(ctx, `
+		SELECT u.id, COALESCE(up.retention_days, op.retention_days, $1)
+		FROM users u
+		LEFT JOIN retention_policies up ON up.user_id = u.id
+		LEFT JOIN retention_policies op ON op.organization_id = u.organization_id`,
+		rs.defaultDays,
+	)
+	if err != nil {
+		return err
+	}
+
+	type userPolicy struct {
+		userID int
+		days   int
+	}
+	var policies []userPolicy
+	for rows.Next() {
+		var p userPolicy
+		if err := rows.Scan(&p.userID, &p.days); err != nil {
+			rows.Close()
+			return err
+		}
+		if p.days > 0 {
+			policies = append(policies, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range policies {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		cutoff := time.Now().UTC().AddDate(0, 0, -p.days)
+		if err := rs.archiveUserEvents(ctx, p.userID, cutoff); err != nil {
+			log.Printf("Retention: user %d failed: %v", p.userID, err)
+		}
+	}
+	return nil
+}
+
+// Выгружает события пользователя старше cutoff в архив и удаляет их из базы
+func (rs *RetentionService) archiveUserEvents(ctx context.Context, userID int, cutoff time.Time) error {
+	var pending int
+	err := rs.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM events e JOIN sessions s ON s.id = e.session_id
+		WHERE s.user_id = $1 AND e.timestamp < $2 AND e.restored_from_archive_id IS NULL`,
+		userID, cutoff,
+	).Scan(&pending)
+	if err != nil || pending == 0 {
+		return err
+	}
+
+	if err := os.MkdirAll(rs.archiveDir, 0o750); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("events-user%d-%s.ndjson.gz", userID, time.Now().UTC().Format("20060102T150405"))
+	path := filepath.Join(rs.archiveDir, name)
+
+	sessions, eventIDs, err := rs.writeArchive(ctx, path, userID, cutoff)
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	// Удаляем ровно то, что попало в архив, по id выгруженных событий: события, которые
+	// закоммитили после чтения архива (например, импорт со старыми отметками времени),
+	// остаются до следующего запуска
+	tx, err := rs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO event_archives (user_id, file_path, cutoff, sessions_count, events_count, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		userID, path, cutoff, sessions, len(eventIDs), info.Size(),
+	)
+	if err != nil {
+		return err
+	}
+
+	var deleted int64
+	for start := 0; start < len(eventIDs); start += retentionDeleteChunk {
+		end := min(start+retentionDeleteChunk, len(eventIDs))
+		result, err := tx.ExecContext(ctx, "DELETE FROM events WHERE id = ANY($1)", eventIDs[start:end])
+		if err != nil {
+			return err
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Retention: user %d archived %d events from %d sessions to %s, deleted %d", userID, len(eventIDs), sessions, path, deleted)
+	return nil
+}
+
+// Пишет архив и возвращает число сеансов и id выгруженных событий
+func (rs *RetentionService) writeArchive(ctx context.Context, path string, userID int, cutoff time.Time) (int, []int, error) {
+	rows, err := rs.db.QueryContext(ctx,
+		`SELECT s.id, s.user_id, s.start_time, s.end_time, s.status, s.notes,
+			e.id, e.drowsiness_score, e.is_drowsy, e.timestamp, e.perclos, e.blink_rate, e.long_blinks
+		FROM events e JOIN sessions s ON s.id = e.session_id
+		WHERE s.user_id = $1 AND e.timestamp < $2 AND e.restored_from_archive_id IS NULL
+		ORDER BY s.id, e.timestamp, e.id`,
+		userID, cutoff,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	// Пишем во временный файл и переименовываем только после полной записи
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+
+	sessions, lastSessionID := 0, 0
+	var eventIDs []int
+	for rows.Next() {
+		var s models.Session
+		var e models.Event
+		var endTime sql.NullTime
+		var notes sql.NullString
+		var isDrowsyInt int
+		if err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &endTime, &s.Status, &notes,
+			&e.ID, &e.DrowsinessScore, &isDrowsyInt, &e.Timestamp, &e.Perclos, &e.BlinkRate, &e.LongBlinks); err != nil {
+			return 0, nil, err
+		}
+
+		if s.ID != lastSessionID {
+			if endTime.Valid {
+				s.EndTime = &endTime.Time
+			}
+			s.Notes = notes.String
+			if err := enc.Encode(models.ExportRecord{Type: "session", Session: &s}); err != nil {
+				return 0, nil, err
+			}
+			lastSessionID = s.ID
+			sessions++
+		}
+
+		e.SessionID = s.ID
+		e.IsDrowsy = isDrowsyInt == 1
+		if err := enc.Encode(models.ExportRecord{Type: "event", Event: &e}); err != nil {
+			return 0, nil, err
+		}
+		eventIDs = append(eventIDs, e.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return 0, nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, nil, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, nil, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return 0, nil, err
+	}
+	return sessions, eventIDs, nil
+}
+
+// RestoreArchive загружает события из архива обратно. События возвращаются
+// в свои сеансы; если сеанс уже удалён или лежит в корзине, он создаётся заново.
+// Каждый сеанс восстанавливается в отдельной транзакции вместе с отметкой в
+// event_archive_sessions, поэтому повторный запуск после сбоя пропускает
+// уже восстановленные сеансы и не дублирует события
+func RestoreArchive(ctx context.Context, db *sql.DB, archiveID int) (*RestoreReport, error) {
+	var path, status string
+	err := db.QueryRowContext(ctx,
+		"SELECT file_path, status FROM event_archives WHERE id = $1",
+		archiveID,
+	).Scan(&path, &status)
+	if err != nil {
+		return nil, err
+	}
+	if status == "restored" {
+		return nil, fmt.Errorf("archive %d is already restored", archiveID)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	report := &RestoreReport{}
+	var tx *sql.Tx
+	archivedSessionID, targetSessionID, sessionEvents := 0, 0, 0
+	// Сеанс уже восстановлен предыдущим запуском: его события пропускаются
+	skipping := false
+
+	commit := func() error {
+		if tx == nil {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO event_archive_sessions (archive_id, archived_session_id, session_id, events_count)
+			VALUES ($1, $2, $3, $4)`,
+			archiveID, archivedSessionID, targetSessionID, sessionEvents,
+		)
+		if err == nil {
+			err = tx.Commit()
+		}
+		tx = nil
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	dec := json.NewDecoder(gz)
+	for {
+		var rec models.ExportRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("invalid archive %s: %w", path, err)
+		}
+
+		switch {
+		case rec.Type == "session" && rec.Session != nil:
+			if err := commit(); err != nil {
+				return report, err
+			}
+
+			s := rec.Session
+			var done bool
+			err = db.QueryRowContext(ctx,
+				"SELECT EXISTS (SELECT 1 FROM event_archive_sessions WHERE archive_id = $1 AND archived_session_id = $2)",
+				archiveID, s.ID,
+			).Scan(&done)
+			if err != nil {
+				return report, fmt.Errorf("session %d: %w", s.ID, err)
+			}
+			skipping = done
+			if done {
+				report.SessionsSkipped++
+				continue
+			}
+
+			if tx, err = db.BeginTx(ctx, nil); err != nil {
+				return report, err
+			}
+			archivedSessionID, sessionEvents = s.ID, 0
+			// Сеанс из корзины не используется: очистка корзины удалила бы события снова
+			err = tx.QueryRowContext(ctx,
+				"SELECT id FROM sessions WHERE id = $1 AND deleted_at IS NULL", s.ID,
+			).Scan(&targetSessionID)
+			if err == sql.ErrNoRows {
+				var endTime sql.NullTime
+				if s.EndTime != nil {
+					endTime = sql.NullTime{Time: *s.EndTime, Valid: true}
+				}
+				err = tx.QueryRowContext(ctx,
+					"INSERT INTO sessions (user_id, start_time, end_time, status, notes) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+					s.UserID, s.StartTime, endTime, s.Status, s.Notes,
+				).Scan(&targetSessionID)
+				report.SessionsRecreated++
+			} else {
+				report.SessionsRestored++
+			}
+			if err != nil {
+				return report, fmt.Errorf("session %d: %w", s.ID, err)
+			}
+
+		case rec.Type == "event" && rec.Event != nil:
+			if skipping {
+				continue
+			}
+			if tx == nil {
+				return report, fmt.Errorf("event %d has no session in archive", rec.Event.ID)
+			}
+			isDrowsyInt := 0
+			if rec.Event.IsDrowsy {
+				isDrowsyInt = 1
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO events (session_id, drowsiness_score, is_drowsy, timestamp, perclos, blink_rate, long_blinks, restored_from_archive_id)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				targetSessionID, rec.Event.DrowsinessScore, isDrowsyInt, rec.Event.Timestamp,
+				rec.Event.Perclos, rec.Event.BlinkRate, rec.Event.LongBlinks, archiveID,
+			)
+			if err != nil {
+				return report, fmt.Errorf("event %d: %w", rec.Event.ID, err)
+			}
+			sessionEvents++
+			report.EventsRestored++
+		}
+	}
+	if err := commit(); err != nil {
+		return report, err
+	}
+
+	_, err = db.ExecContext(ctx,
+		"UPDATE event_archives SET status = 'restored', restored_at = $1 WHERE id = $2",
+		time.Now().UTC(), archiveID,
+	)
+	return report, err
+}
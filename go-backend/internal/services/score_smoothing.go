@@ -0,0 +1,66 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"slices"
+)
+
+// ScoreSmoother сглаживает покадровую оценку одного подключения: экспоненциальным
+// скользящим средним (EMA) или медианой последних кадров. Медиана лучше гасит
+// одиночные выбросы, EMA быстрее реагирует на устойчивый рост оценки.
+// Не потокобезопасен: вызывается из обработчика кадров клиента
+type ScoreSmoother struct {
+	method string
+	alpha  float64
+
+	ema    float64
+	primed bool
+
+	window []float64
+	next   int
+	filled int
+	sorted []float64
+}
+
+func NewScoreSmoother(method string, alpha float64, window int) *ScoreSmoother {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 1
+	}
+	if window < 1 {
+		window = 1
+	}
+	s := &ScoreSmoother{method: method, alpha: alpha}
+	if method == models.SmoothingMedian {
+		s.window = make([]float64, window)
+		s.sorted = make([]float64, 0, window)
+	}
+	return s
+}
+
+// Smooth учитывает очередную оценку и возвращает сглаженное значение
+func (s *ScoreSmoother) Smooth(score float64) float64 {
+	switch s.method {
+	case models.SmoothingEMA:
+		if !s.primed {
+			s.ema = score
+			s.primed = true
+		} else {
+			s.ema += s.alpha * (score - s.ema)
+		}
+		return s.ema
+	case models.SmoothingMedian:
+		s.window[s.next] = score
+		s.next = (s.next + 1) % len(s.window)
+		if s.filled < len(s.window) {
+			s.filled++
+		}
+		s.sorted = append(s.sorted[:0], s.window[:s.filled]...)
+		slices.Sort(s.sorted)
+		mid := s.filled / 2
+		if s.filled%2 == 0 {
+			return (s.sorted[mid-1] + s.sorted[mid]) / 2
+		}
+		return s.sorted[mid]
+	}
+	return score
+}
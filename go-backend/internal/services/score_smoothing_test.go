@@ -0,0 +1,64 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"math"
+	"testing"
+)
+
+func TestScoreSmoother(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		alpha  float64
+		window int
+		in     []float64
+		want   []float64
+	}{
+		{
+			name:   "none passes scores through",
+			method: models.SmoothingNone,
+			in:     []float64{0.1, 0.9, 0.3},
+			want:   []float64{0.1, 0.9, 0.3},
+		},
+		{
+			name:   "ema starts from the first score",
+			method: models.SmoothingEMA,
+			alpha:  0.5,
+			in:     []float64{0.2, 0.6, 1.0, 0.0},
+			want:   []float64{0.2, 0.4, 0.7, 0.35},
+		},
+		{
+			name:   "ema with invalid alpha does not smooth",
+			method: models.SmoothingEMA,
+			alpha:  0,
+			in:     []float64{0.2, 0.8},
+			want:   []float64{0.2, 0.8},
+		},
+		{
+			name:   "median ignores a single spike",
+			method: models.SmoothingMedian,
+			window: 3,
+			in:     []float64{0.1, 0.9, 0.1, 0.1},
+			want:   []float64{0.1, 0.5, 0.1, 0.1},
+		},
+		{
+			name:   "median window slides",
+			method: models.SmoothingMedian,
+			window: 3,
+			in:     []float64{0.1, 0.2, 0.3, 0.9, 0.8},
+			want:   []float64{0.1, 0.15, 0.2, 0.3, 0.8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScoreSmoother(tt.method, tt.alpha, tt.window)
+			for i, score := range tt.in {
+				if got := s.Smooth(score); math.Abs(got-tt.want[i]) > 1e-9 {
+					t.Fatalf("frame %d: got %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
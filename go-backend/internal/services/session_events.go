@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Сколько последних событий сеанса хранится для переподключения по Last-Event-ID
+	sessionEventBacklog = 512
+	// Буфер канала подписчика; медленный подписчик отключается и переподключается сам
+	sessionSubscriberBuffer = 64
+)
+
+// Типы событий потока сеанса
+const (
+	SessionEventDetection  = "detection"
+	SessionEventAlertStart = "alert_start"
+	SessionEventAlertEnd   = "alert_end"
+	SessionEventStarted    = "session_start"
+	SessionEventEnded      = "session_end"
+)
+
+type SessionEvent struct {
+	ID        uint64      `json:"id"`
+	SessionID int         `json:"session_id"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	Time      time.Time   `json:"time"`
+}
+
+type sessionTopic struct {
+	backlog      []SessionEvent
+	subscribers  map[chan SessionEvent]struct{}
+	lastActivity time.Time
+}
+
+// SessionEventBus раздаёт события сеансов подписчикам (SSE) в пределах процесса.
+// ID событий монотонно растут по всей шине, поэтому остаются корректными для
+// Last-Event-ID, даже если история сеанса была очищена
+type SessionEventBus struct {
+	mu     sync.Mutex
+	topics map[int]*sessionTopic
+	nextID atomic.Uint64
+}
+
+var (
+	sessionBusInstance *SessionEventBus
+	sessionBusOnce     sync.Once
+)
+
+func NewSessionEventBus() *SessionEventBus {
+	return &SessionEventBus{
+		topics: make(map[int]*sessionTopic),
+	}
+}
+
+func GetSessionEventBus() *SessionEventBus {
+	sessionBusOnce.Do(func() {
+		sessionBusInstance = NewSessionEventBus()
+	})
+	return sessionBusInstance
+}
+
+func (b *SessionEventBus) topic(sessionID int) *sessionTopic {
+	t, ok := b.topics[sessionID]
+	if !ok {
+		t = &sessionTopic{subscribers: make(map[chan SessionEvent]struct{})}
+		b.topics[sessionID] = t
+	}
+	t.lastActivity = time.Now()
+	return t
+}
+
+func (b *SessionEventBus) Publish(sessionID int, eventType string, data interface{}) {
+	evt := SessionEvent{
+		ID:        b.nextID.Add(1),
+		SessionID: sessionID,
+		Type:      eventType,
+		Data:      data,
+		Time:      time.Now().UTC(),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(sessionID)
+	t.backlog = append(t.backlog, evt)
+	if len(t.backlog) > sessionEventBacklog {
+		t.backlog = t.backlog[len(t.backlog)-sessionEventBacklog:]
+	}
+
+	for ch := range t.subscribers {
+		select {
+		case ch <- evt:
+		default:
+			log.Printf("Session %d: subscriber too slow, disconnecting", sessionID)
+			delete(t.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe возвращает пропущенные события с ID больше lastEventID и канал новых.
+// Канал закрывается при отписке или если подписчик не успевает читать
+func (b *SessionEventBus) Subscribe(sessionID int, lastEventID uint64) ([]SessionEvent, <-chan SessionEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(sessionID)
+	var missed []SessionEvent
+	if lastEventID > 0 {
+		for _, evt := range t.backlog {
+			if evt.ID > lastEventID {
+				missed = append(missed, evt)
+			}
+		}
+	}
+
+	ch := make(chan SessionEvent, sessionSubscriberBuffer)
+	t.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := t.subscribers[ch]; ok {
+			delete(t.subscribers, ch)
+			close(ch)
+		}
+	}
+	return missed, ch, unsubscribe
+}
+
+// StartJanitor периодически удаляет историю сеансов без подписчиков и активности
+func (b *SessionEventBus) StartJanitor(ctx context.Context, maxIdle time.Duration) {
+	ticker := time.NewTicker(maxIdle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			for id, t := range b.topics {
+				if len(t.subscribers) == 0 && time.Since(t.lastActivity) > maxIdle {
+					delete(b.topics, id)
+				}
+			}
+			b.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// ErrInvalidImport - ошибка в самой выгрузке (формат, порядок записей); остальные ошибки
+// ImportSessions - сбои чтения или базы
+var ErrInvalidImport = errors.New("invalid import")
+
+type ImportOptions struct {
+	// Владелец импортируемых сеансов. 0 - оставить владельца из архива
+	UserID int
+	// Принимать сеансы, у которых user_id в архиве отличается от UserID.
+	// HTTP-импорт это запрещает, CLI разрешает явным флагом
+	AllowForeignOwner bool
+	// Предельный размер одного сеанса в выгрузке (байты JSON). 0 - importMaxSessionBytes
+	MaxSessionBytes int64
+}
+
+// Сеанс читается в память целиком до открытия транзакции, поэтому его размер ограничен
+const importMaxSessionBytes = 64 << 20
+
+type ImportRejection struct {
+	SourceSessionID int    `json:"source_session_id"`
+	Reason          string `json:"reason"`
+}
+
+type ImportReport struct {
+	SessionsImported    int               `json:"sessions_imported"`
+	EventsImported      int               `json:"events_imported"`
+	AnnotationsImported int               `json:"annotations_imported"`
+	Duplicates          []int             `json:"duplicates"`
+	InTrash             []int             `json:"in_trash"`
+	Rejected            []ImportRejection `json:"rejected"`
+	IDMap               map[int]int       `json:"id_map"`
+}
+
+// Сеанс выгрузки, прочитанный в память вместе с событиями и разметкой
+type bufferedSession struct {
+	session     *models.Session
+	events      []*models.Event
+	annotations []*models.Annotation
+	start       int64
+	oversized   bool
+}
+
+// Импортируемый сеанс: открыт в своей транзакции, пока пишутся его события и разметка
+type sessionImport struct {
+	sourceID    int
+	sourceOwner int
+	ownerID     int
+	newID       int
+	tx          *sql.Tx
+	events      int
+	annotations int
+	eventIDs    map[int]int
+	skip        bool
+}
+
+type sessionImporter struct {
+	ctx     context.Context
+	db      *sql.DB
+	opts    ImportOptions
+	report  *ImportReport
+	current *sessionImport
+}
+
+// ImportSessions читает NDJSON-выгрузку (формат /api/sessions/export?format=ndjson)
+// и загружает сеансы с событиями и разметкой. Сеанс сначала читается целиком, затем пишется
+// в отдельной транзакции: медленный клиент не держит транзакцию открытой.
+// ID сеансов и событий назначаются заново
+func ImportSessions(ctx context.Context, db *sql.DB, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	im := &sessionImporter{
+		ctx:  ctx,
+		db:   db,
+		opts: opts,
+		report: &ImportReport{
+			Duplicates: []int{},
+			InTrash:    []int{},
+			Rejected:   []ImportRejection{},
+			IDMap:      make(map[int]int),
+		},
+	}
+	defer im.rollback()
+
+	maxBytes := opts.MaxSessionBytes
+	if maxBytes <= 0 {
+		maxBytes = importMaxSessionBytes
+	}
+
+	var pending *bufferedSession
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var rec models.ExportRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if isMalformedImport(err) {
+				return im.report, fmt.Errorf("%w: record %d: invalid json: %v", ErrInvalidImport, line, err)
+			}
+			return im.report, fmt.Errorf("record %d: read failed: %w", line, err)
+		}
+
+		// Слишком большой сеанс дочитывается без сохранения записей и отклоняется
+		if pending != nil && !pending.oversized && dec.InputOffset()-pending.start > maxBytes {
+			pending.oversized = true
+			pending.events, pending.annotations = nil, nil
+		}
+
+		switch rec.Type {
+		case "session":
+			if rec.Session == nil {
+				return im.report, fmt.Errorf("%w: record %d: session record without session", ErrInvalidImport, line)
+			}
+			im.importSession(pending)
+			pending = &bufferedSession{session: rec.Session, start: dec.InputOffset()}
+
+		case "event":
+			if rec.Event == nil {
+				return im.report, fmt.Errorf("%w: record %d: event record without event", ErrInvalidImport, line)
+			}
+			if pending == nil || rec.Event.SessionID != pending.session.ID {
+				return im.report, fmt.Errorf("%w: record %d: event %d does not follow its session %d", ErrInvalidImport, line, rec.Event.ID, rec.Event.SessionID)
+			}
+			if !pending.oversized {
+				pending.events = append(pending.events, rec.Event)
+			}
+
+		case "annotation":
+			if rec.Annotation == nil {
+				return im.report, fmt.Errorf("%w: record %d: annotation record without annotation", ErrInvalidImport, line)
+			}
+			if pending == nil || rec.Annotation.SessionID != pending.session.ID {
+				return im.report, fmt.Errorf("%w: record %d: annotation %d does not follow its session %d", ErrInvalidImport, line, rec.Annotation.ID, rec.Annotation.SessionID)
+			}
+			if !pending.oversized {
+				pending.annotations = append(pending.annotations, rec.Annotation)
+			}
+
+		default:
+			log.Printf("Import: skipping record %d with unknown type %q", line, rec.Type)
+		}
+	}
+	im.importSession(pending)
+
+	return im.report, nil
+}
+
+// Пишет прочитанный сеанс в его транзакции
+func (im *sessionImporter) importSession(b *bufferedSession) {
+	if b == nil {
+		return
+	}
+	if b.oversized {
+		im.current = &sessionImport{sourceID: b.session.ID}
+		im.reject("session exceeds import size limit")
+		im.current = nil
+		return
+	}
+
+	im.begin(b.session, b.events)
+	for _, e := range b.events {
+		im.addEvent(e)
+	}
+	for _, a := range b.annotations {
+		im.addAnnotation(a)
+	}
+	im.finish()
+}
+
+// Ошибки декодирования, вызванные содержимым выгрузки, а не сбоем чтения
+func isMalformedImport(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader)
+}
+
+func (im *sessionImporter) reject(reason string) {
+	im.rollback()
+	im.current.skip = true
+	im.report.Rejected = append(im.report.Rejected, ImportRejection{
+		SourceSessionID: im.current.sourceID,
+		Reason:          reason,
+	})
+}
+
+func (im *sessionImporter) rollback() {
+	if im.current != nil && im.current.tx != nil {
+		im.current.tx.Rollback()
+		im.current.tx = nil
+	}
+}
+
+func (im *sessionImporter) begin(s *models.Session, events []*models.Event) {
+	im.current = &sessionImport{sourceID: s.ID, sourceOwner: s.UserID, eventIDs: make(map[int]int)}
+
+	ownerID := s.UserID
+	if im.opts.UserID != 0 {
+		if s.UserID != im.opts.UserID && !im.opts.AllowForeignOwner {
+			im.reject("session belongs to another user")
+			return
+		}
+		ownerID = im.opts.UserID
+	}
+	im.current.ownerID = ownerID
+
+	// Дубликатом считается сеанс того же владельца с тем же временем начала.
+	// Совпавший сеанс из корзины не подменяет импортируемый молча: о нём сообщается отдельно
+	var existingID int
+	var inTrash bool
+	err := im.db.QueryRowContext(im.ctx,
+		`SELECT id, deleted_at IS NOT NULL FROM sessions WHERE user_id = $1 AND start_time = $2
+		ORDER BY deleted_at IS NOT NULL LIMIT 1`,
+		ownerID, s.StartTime,
+	).Scan(&existingID, &inTrash)
+	if err == nil {
+		im.current.skip = true
+		if inTrash {
+			im.report.InTrash = append(im.report.InTrash, s.ID)
+			return
+		}
+		im.report.Duplicates = append(im.report.Duplicates, s.ID)
+		im.report.IDMap[s.ID] = existingID
+		return
+	} else if err != sql.ErrNoRows {
+		log.Printf("Import: duplicate check failed for source session %d: %v", s.ID, err)
+		im.reject("duplicate check failed")
+		return
+	}
+
+	im.current.tx, err = im.db.BeginTx(im.ctx, nil)
+	if err != nil {
+		log.Printf("Import: failed to begin transaction: %v", err)
+		im.reject("failed to begin transaction")
+		return
+	}
+
+	// Импортированный сеанс всегда завершён: активный сеанс начинается только через
+	// StartSession с проверкой SINGLE_ACTIVE_SESSION. Без времени окончания сеанс
+	// заканчивается последним событием
+	endTime := s.StartTime
+	if s.EndTime != nil {
+		endTime = *s.EndTime
+	} else {
+		for _, e := range events {
+			if e.Timestamp.After(endTime) {
+				endTime = e.Timestamp
+			}
+		}
+	}
+	state := s.State
+	if state == "" {
+		state = models.SessionStateDriving
+	}
+
+	err = im.current.tx.QueryRowContext(im.ctx,
+		`INSERT INTO sessions (user_id, start_time, end_time, status, notes, vehicle_id, state)
+		VALUES ($1, $2, $3, 'completed', $4, $5, $6) RETURNING id`,
+		ownerID, s.StartTime, endTime, s.Notes, s.VehicleID, state,
+	).Scan(&im.current.newID)
+	if err != nil {
+		log.Printf("Import: failed to insert source session %d: %v", s.ID, err)
+		im.reject("failed to insert session")
+	}
+}
+
+func (im *sessionImporter) addEvent(e *models.Event) {
+	if im.current.skip {
+		return
+	}
+
+	isDrowsyInt := 0
+	if e.IsDrowsy {
+		isDrowsyInt = 1
+	}
+	var newID int
+	err := im.current.tx.QueryRowContext(im.ctx,
+		`INSERT INTO events (session_id, drowsiness_score, is_drowsy, timestamp, perclos, blink_rate, long_blinks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		im.current.newID, e.DrowsinessScore, isDrowsyInt, e.Timestamp, e.Perclos, e.BlinkRate, e.LongBlinks,
+	).Scan(&newID)
+	if err != nil {
+		log.Printf("Import: failed to insert event %d: %v", e.ID, err)
+		im.reject("failed to insert events")
+		return
+	}
+	im.current.eventIDs[e.ID] = newID
+	im.current.events++
+}
+
+func (im *sessionImporter) addAnnotation(a *models.Annotation) {
+	if im.current.skip {
+		return
+	}
+
+	var eventID *int
+	if a.EventID != nil {
+		newID, ok := im.current.eventIDs[*a.EventID]
+		if !ok {
+			log.Printf("Import: annotation %d refers to unknown event %d, skipped", a.ID, *a.EventID)
+			return
+		}
+		eventID = &newID
+	}
+
+	// Автор сохраняется, только если это владелец сеанса: ID других
+	// пользователей в другом окружении не имеют смысла
+	var authorID *int
+	if a.AuthorID != nil && *a.AuthorID == im.current.sourceOwner {
+		authorID = &im.current.ownerID
+	}
+
+	_, err := im.current.tx.ExecContext(im.ctx,
+		`INSERT INTO event_annotations (session_id, event_id, start_time, end_time, label, comment, author_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		im.current.newID, eventID, a.StartTime, a.EndTime, a.Label, a.Comment, authorID, a.CreatedAt,
+	)
+	if err != nil {
+		log.Printf("Import: failed to insert annotation %d: %v", a.ID, err)
+		im.reject("failed to insert annotations")
+		return
+	}
+	im.current.annotations++
+}
+
+func (im *sessionImporter) finish() {
+	if im.current == nil || im.current.skip {
+		im.current = nil
+		return
+	}
+	if err := im.current.tx.Commit(); err != nil {
+		log.Printf("Import: commit failed for source session %d: %v", im.current.sourceID, err)
+		im.current.tx = nil
+		im.reject("commit failed")
+	} else {
+		im.report.SessionsImported++
+		im.report.EventsImported += im.current.events
+		im.report.AnnotationsImported += im.current.annotations
+		im.report.IDMap[im.current.sourceID] = im.current.newID
+	}
+	im.current = nil
+}
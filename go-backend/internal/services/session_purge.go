@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// SessionPurger окончательно удаляет сеансы, пролежавшие в корзине дольше срока
+type SessionPurger struct {
+	db       *sql.DB
+	after    time.Duration
+	interval time.Duration
+}
+
+func NewSessionPurger(db *sql.DB, after, interval time.Duration) *SessionPurger {
+	return &SessionPurger{
+		db:       db,
+		after:    after,
+		interval: interval,
+	}
+}
+
+func (sp *SessionPurger) Start(ctx context.Context) {
+	log.Printf("Session purge job started: trash kept %v, every %v", sp.after, sp.interval)
+
+	ticker := time.NewTicker(sp.interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := sp.RunOnce(ctx); err != nil {
+			log.Printf("Session purge failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("Session purge: %d sessions deleted permanently", purged)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("Session purge job stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce удаляет просроченные сеансы; каждый - в своей транзакции,
+// чтобы сеанс, восстановленный во время очистки, не пострадал
+func (sp *SessionPurger) RunOnce(ctx context.Context) (int, error) {
+	cutoff := time.Now().UTC().Add(-sp.after)
+
+	rows, err := sp.db.QueryContext(ctx,
+		"SELECT id FROM sessions WHERE deleted_at IS NOT NULL AND deleted_at < $1",
+		cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return purged, ctx.Err()
+		}
+		ok, err := sp.purgeSession(ctx, id, cutoff)
+		if err != nil {
+			log.Printf("Session purge: session %d failed: %v", id, err)
+			continue
+		}
+		if ok {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (sp *SessionPurger) purgeSession(ctx context.Context, sessionID int, cutoff time.Time) (bool, error) {
+	tx, err := sp.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Блокируем строку и перепроверяем, что сеанс всё ещё в корзине
+	var id int
+	err = tx.QueryRowContext(ctx,
+		"SELECT id FROM sessions WHERE id = $1 AND deleted_at IS NOT NULL AND deleted_at < $2 FOR UPDATE",
+		sessionID, cutoff,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM events WHERE session_id = $1", sessionID); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE id = $1", sessionID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
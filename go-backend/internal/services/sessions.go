@@ -0,0 +1,203 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ActiveSessionError - у пользователя уже есть активный сеанс, а разрешён только один
+type ActiveSessionError struct {
+	Session models.Session
+}
+
+func (e *ActiveSessionError) Error() string {
+	return fmt.Sprintf("user already has an active session %d", e.Session.ID)
+}
+
+// StartSession создаёт активный сеанс пользователя. При singleActive и уже
+// активном сеансе возвращает *ActiveSessionError с этим сеансом
+func StartSession(ctx context.Context, db *sql.DB, userID int, notes, vehicleID string, singleActive bool) (models.Session, error) {
+	s := models.Session{
+		UserID:    userID,
+		Status:    "active",
+		Notes:     notes,
+		VehicleID: strings.TrimSpace(vehicleID),
+		State:     models.SessionStateDriving,
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return s, err
+	}
+	defer tx.Rollback()
+
+	if singleActive {
+		// Блокировка на пользователя до конца транзакции: параллельные запросы
+		// не смогут одновременно пройти проверку и создать два активных сеанса
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(1, $1)", userID); err != nil {
+			return s, err
+		}
+
+		var active models.Session
+		var activeNotes sql.NullString
+		err := tx.QueryRowContext(ctx,
+			`SELECT id, user_id, start_time, status, notes FROM sessions
+			WHERE user_id = $1 AND status = 'active' AND deleted_at IS NULL
+			ORDER BY start_time DESC LIMIT 1`,
+			userID,
+		).Scan(&active.ID, &active.UserID, &active.StartTime, &active.Status, &activeNotes)
+		if err == nil {
+			active.Notes = activeNotes.String
+			return s, &ActiveSessionError{Session: active}
+		} else if err != sql.ErrNoRows {
+			return s, err
+		}
+	}
+
+	s.StartTime = time.Now().UTC()
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO sessions (user_id, notes, status, start_time, vehicle_id) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		userID, notes, s.Status, s.StartTime, s.VehicleID,
+	).Scan(&s.ID)
+	if err != nil {
+		return s, err
+	}
+	return s, tx.Commit()
+}
+
+// RestoreSessions возвращает сеансы пользователя из корзины и возвращает их id.
+// При singleActive активные сеансы восстанавливаются так, чтобы активным остался
+// один: если у пользователя уже есть активный сеанс, восстановленные завершаются,
+// иначе активным остаётся самый поздний из восстановленных
+func RestoreSessions(ctx context.Context, db *sql.DB, userID int, sessionIDs []int, singleActive bool) ([]int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if singleActive {
+		// Та же блокировка, что и в StartSession
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(1, $1)", userID); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		"UPDATE sessions SET deleted_at = NULL WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NOT NULL RETURNING id",
+		sessionIDs, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	restored := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		restored = append(restored, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if singleActive && len(restored) > 0 {
+		// Сначала не восстановленные (false < true), затем самый поздний
+		_, err := tx.ExecContext(ctx,
+			`UPDATE sessions SET status = 'completed', end_time = COALESCE(end_time, $3)
+			WHERE id = ANY($1) AND status = 'active' AND id <> (
+				SELECT id FROM sessions WHERE user_id = $2 AND status = 'active' AND deleted_at IS NULL
+				ORDER BY id = ANY($1), start_time DESC LIMIT 1
+			)`,
+			restored, userID, time.Now().UTC(),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return restored, tx.Commit()
+}
+
+// LoadActiveSession возвращает активный сеанс, принадлежащий пользователю, или sql.ErrNoRows
+func LoadActiveSession(ctx context.Context, db *sql.DB, userID, sessionID int) (models.Session, error) {
+	var s models.Session
+	var notes sql.NullString
+	err := db.QueryRowContext(ctx,
+		`SELECT id, user_id, start_time, status, notes, vehicle_id, state FROM sessions
+		WHERE id = $1 AND user_id = $2 AND status = 'active' AND deleted_at IS NULL`,
+		sessionID, userID,
+	).Scan(&s.ID, &s.UserID, &s.StartTime, &s.Status, &notes, &s.VehicleID, &s.State)
+	s.Notes = notes.String
+	return s, err
+}
+
+// EndSession завершает активный сеанс пользователя и рассылает session_end в поток сеанса и подписчикам.
+// Возвращает false, если сеанс не найден, не принадлежит пользователю или уже завершён:
+// повторное завершение не меняет end_time и ничего не публикует
+func EndSession(ctx context.Context, db *sql.DB, userID, sessionID int, endTime time.Time) (bool, error) {
+	result, err := db.ExecContext(ctx,
+		"UPDATE sessions SET end_time = $1, status = 'completed' WHERE id = $2 AND user_id = $3 AND status = 'active' AND deleted_at IS NULL",
+		endTime, sessionID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	GetSessionEventBus().Publish(sessionID, SessionEventEnded, nil)
+	if err := PublishEvent(ctx, db, userID, models.WebhookSessionEnd, map[string]interface{}{
+		"session_id": sessionID,
+		"end_time":   endTime,
+	}); err != nil {
+		log.Printf("Failed to publish session end event: %v", err)
+	}
+	return true, nil
+}
+
+// ErrSessionNotActive - сеанс завершён или перенесён в корзину, события в него не пишутся
+var ErrSessionNotActive = errors.New("session is not active")
+
+// SaveDetectionEvent сохраняет покадровый результат в активный сеанс и публикует его в поток сеанса.
+// Если сеанс уже не активен, возвращает ErrSessionNotActive
+func SaveDetectionEvent(ctx context.Context, db *sql.DB, req models.CreateEventRequest) (models.Event, error) {
+	isDrowsyInt := 0
+	if req.IsDrowsy {
+		isDrowsyInt = 1
+	}
+
+	event := models.Event{
+		SessionID:       req.SessionID,
+		DrowsinessScore: req.DrowsinessScore,
+		IsDrowsy:        req.IsDrowsy,
+		Perclos:         req.Perclos,
+		BlinkRate:       req.BlinkRate,
+		LongBlinks:      req.LongBlinks,
+		Timestamp:       time.Now().UTC(),
+	}
+	err := db.QueryRowContext(ctx,
+		`INSERT INTO events (session_id, drowsiness_score, is_drowsy, perclos, blink_rate, long_blinks)
+		SELECT $1::int, $2::real, $3::int, $4::real, $5::real, $6::int
+		WHERE EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND status = 'active' AND deleted_at IS NULL)
+		RETURNING id`,
+		req.SessionID, req.DrowsinessScore, isDrowsyInt, req.Perclos, req.BlinkRate, req.LongBlinks,
+	).Scan(&event.ID)
+	if err == sql.ErrNoRows {
+		return event, ErrSessionNotActive
+	} else if err != nil {
+		return event, err
+	}
+
+	GetSessionEventBus().Publish(req.SessionID, SessionEventDetection, event)
+	return event, nil
+}
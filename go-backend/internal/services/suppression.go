@@ -0,0 +1,254 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const SuppressionRuleColumns = `id, user_id, vehicle_id, organization_id, kind, starts_at, ends_at, daily_start, daily_end,
+	timezone, states, reason, source, created_by, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func ScanSuppressionRule(row rowScanner) (models.SuppressionRule, error) {
+	var rule models.SuppressionRule
+	var userID, orgID, createdBy sql.NullInt64
+	var vehicleID sql.NullString
+	var startsAt, endsAt sql.NullTime
+	var states string
+	err := row.Scan(&rule.ID, &userID, &vehicleID, &orgID, &rule.Kind, &startsAt, &endsAt, &rule.DailyStart, &rule.DailyEnd,
+		&rule.Timezone, &states, &rule.Reason, &rule.Source, &createdBy, &rule.CreatedAt)
+	if userID.Valid {
+		id := int(userID.Int64)
+		rule.UserID = &id
+	}
+	if vehicleID.Valid {
+		rule.VehicleID = &vehicleID.String
+	}
+	if orgID.Valid {
+		id := int(orgID.Int64)
+		rule.OrganizationID = &id
+	}
+	if startsAt.Valid {
+		rule.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		rule.EndsAt = &endsAt.Time
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		rule.CreatedBy = &id
+	}
+	if states != "" {
+		rule.States = strings.Split(states, ",")
+	}
+	return rule, err
+}
+
+// Минуты от полуночи для "HH:MM"
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ValidateSuppressionRule проверяет параметры правила в зависимости от его вида
+func ValidateSuppressionRule(rule models.SuppressionRule) error {
+	switch rule.Kind {
+	case models.SuppressionWindow:
+		if rule.EndsAt == nil {
+			return fmt.Errorf("ends_at is required for window rules")
+		}
+		if rule.StartsAt != nil && !rule.EndsAt.After(*rule.StartsAt) {
+			return fmt.Errorf("ends_at must be after starts_at")
+		}
+	case models.SuppressionDaily:
+		if _, err := parseClock(rule.DailyStart); err != nil {
+			return err
+		}
+		if _, err := parseClock(rule.DailyEnd); err != nil {
+			return err
+		}
+		if rule.DailyStart == rule.DailyEnd {
+			return fmt.Errorf("daily_start and daily_end must differ")
+		}
+		if _, err := time.LoadLocation(rule.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", rule.Timezone)
+		}
+	case models.SuppressionSessionState:
+		if len(rule.States) == 0 {
+			return fmt.Errorf("states are required for session_state rules")
+		}
+		for _, s := range rule.States {
+			switch s {
+			case models.SessionStateParking, models.SessionStateLoading, models.SessionStateCalibration, models.SessionStateDriving:
+			default:
+				return fmt.Errorf("unknown session state %q", s)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown rule kind %q", rule.Kind)
+	}
+	return nil
+}
+
+// SuppressionRuleActive сообщает, действует ли правило в момент at при состоянии сеанса state
+func SuppressionRuleActive(rule models.SuppressionRule, at time.Time, state string) bool {
+	switch rule.Kind {
+	case models.SuppressionWindow:
+		if rule.StartsAt != nil && at.Before(*rule.StartsAt) {
+			return false
+		}
+		return rule.EndsAt != nil && at.Before(*rule.EndsAt)
+	case models.SuppressionDaily:
+		loc, err := time.LoadLocation(rule.Timezone)
+		if err != nil {
+			return false
+		}
+		start, err1 := parseClock(rule.DailyStart)
+		end, err2 := parseClock(rule.DailyEnd)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		local := at.In(loc)
+		minute := local.Hour()*60 + local.Minute()
+		if start < end {
+			return minute >= start && minute < end
+		}
+		// Интервал через полночь, например 22:00-06:00
+		return minute >= start || minute < end
+	case models.SuppressionSessionState:
+		return state != "" && slices.Contains(rule.States, state)
+	}
+	return false
+}
+
+// Результат проверки подавления: сработавшее правило и активный сеанс пользователя
+type SuppressionMatch struct {
+	Rule      models.SuppressionRule
+	SessionID *int
+}
+
+// SuppressionStore проверяет правила подавления и хранит подавленные тревоги
+type SuppressionStore struct {
+	db *sql.DB
+}
+
+func NewSuppressionStore(db *sql.DB) *SuppressionStore {
+	return &SuppressionStore{db: db}
+}
+
+// Match возвращает первое правило, подавляющее тревогу пользователя в момент at, или nil.
+// Правила транспортного средства и состояние берутся из сеанса boundSession, а без него -
+// из последнего активного сеанса пользователя. Правило транспорта действует, только если
+// пользователь состоит в организации правила
+func (s *SuppressionStore) Match(ctx context.Context, userID int, boundSession *int, at time.Time) (*SuppressionMatch, error) {
+	var sessionID sql.NullInt64
+	var vehicleID, state string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, vehicle_id, state FROM sessions WHERE user_id = $1 AND status = 'active' AND deleted_at IS NULL
+		AND ($2::int IS NULL OR id = $2)
+		ORDER BY start_time DESC LIMIT 1`,
+		userID, boundSession,
+	).Scan(&sessionID, &vehicleID, &state)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+SuppressionRuleColumns+` FROM suppression_rules
+		WHERE (user_id = $1 OR ($2 <> '' AND vehicle_id = $2
+			AND organization_id = (SELECT organization_id FROM users WHERE id = $1)))
+		AND (kind <> 'window' OR ends_at > $3)
+		ORDER BY id`,
+		userID, vehicleID, at,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rule, err := ScanSuppressionRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		if SuppressionRuleActive(rule, at, state) {
+			match := &SuppressionMatch{Rule: rule}
+			if sessionID.Valid {
+				id := int(sessionID.Int64)
+				match.SessionID = &id
+			}
+			return match, nil
+		}
+	}
+	return nil, rows.Err()
+}
+
+// RecordSuppressed сохраняет начало подавленной тревоги и возвращает её ID
+func (s *SuppressionStore) RecordSuppressed(ctx context.Context, ep *models.AlertEpisode, match *SuppressionMatch) (int, error) {
+	reason := match.Rule.Reason
+	if reason == "" {
+		reason = match.Rule.Kind
+	}
+	var id int
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO suppressed_alerts (user_id, session_id, rule_id, reason, client_id, start_time, peak_score, severity, frames, alert_type)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+		ep.UserID, match.SessionID, match.Rule.ID, reason, ep.ClientID, ep.StartTime, ep.PeakScore, ep.Severity, ep.Frames,
+		ep.AlertType,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *SuppressionStore) CloseSuppressed(ctx context.Context, id int, ep *models.AlertEpisode) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE suppressed_alerts SET end_time = $1, peak_score = $2, severity = $3, frames = $4 WHERE id = $5",
+		ep.EndTime, ep.PeakScore, ep.Severity, ep.Frames, id,
+	)
+	return err
+}
+
+// SuppressFor создаёт правило-окно по команде пользователя: тревоги подавляются d от текущего момента
+func (s *SuppressionStore) SuppressFor(ctx context.Context, userID int, d time.Duration, reason string) (models.SuppressionRule, error) {
+	now := time.Now().UTC()
+	until := now.Add(d)
+	rule := models.SuppressionRule{
+		UserID:    &userID,
+		Kind:      models.SuppressionWindow,
+		StartsAt:  &now,
+		EndsAt:    &until,
+		Timezone:  "UTC",
+		Reason:    reason,
+		Source:    "command",
+		CreatedBy: &userID,
+	}
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO suppression_rules (user_id, kind, starts_at, ends_at, reason, source, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`,
+		userID, rule.Kind, now, until, reason, rule.Source, userID,
+	).Scan(&rule.ID, &rule.CreatedAt)
+	return rule, err
+}
+
+// CancelCommandSuppression досрочно завершает действующие окна, созданные командой пользователя
+func (s *SuppressionStore) CancelCommandSuppression(ctx context.Context, userID int) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE suppression_rules SET ends_at = NOW()
+		WHERE user_id = $1 AND source = 'command' AND ends_at > NOW()`,
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"AI_DETECTOR/go-backend/internal/models"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	webhookBatchSize   = 20
+	webhookBaseBackoff = 10 * time.Second
+	webhookMaxBackoff  = time.Hour
+	// Сколько байт ответа сохраняется в журнале при ошибке
+	webhookErrorBodyLimit = 512
+)
+
+// Будит диспетчер сразу после постановки доставки в очередь
+var webhookWake = make(chan struct{}, 1)
+
+// EnqueueWebhookEvent ставит событие в очередь всех активных webhook пользователя
+// и его организации, подписанных на этот тип события
+func EnqueueWebhookEvent(ctx context.Context, db *sql.DB, userID int, eventType string, data interface{}) error {
+	payload, err := json.Marshal(models.WebhookPayload{
+		Event:     eventType,
+		UserID:    userID,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	result, err := db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+		SELECT w.id, $2, $3 FROM webhooks w JOIN users u ON u.id = $1
+		WHERE w.active AND (w.user_id = u.id OR w.organization_id = u.organization_id)
+		AND $2 = ANY(string_to_array(w.events, ','))`,
+		userID, eventType, string(payload),
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		select {
+		case webhookWake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// SignWebhook возвращает подпись тела: hex(HMAC-SHA256(secret, "<timestamp>.<body>"))
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Экспоненциальная задержка перед попыткой attempt+1 с разбросом ±20%
+func webhookBackoff(attempt int) time.Duration {
+	d := webhookBaseBackoff << min(attempt-1, 20)
+	if d > webhookMaxBackoff || d <= 0 {
+		d = webhookMaxBackoff
+	}
+	jitter := time.Duration(rand.Int64N(int64(d)/5*2+1)) - d/5
+	return d + jitter
+}
+
+type webhookJob struct {
+	id       int64
+	event    string
+	payload  []byte
+	attempts int
+	url      string
+	secret   string
+}
+
+// WebhookDispatcher доставляет события из очереди webhook_deliveries.
+// Доставка захватывается арендой (next_attempt_at сдвигается вперёд), поэтому
+// при падении процесса она будет повторена, а несколько экземпляров не разберут одну строку дважды
+type WebhookDispatcher struct {
+	db          *sql.DB
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+	timeout     time.Duration
+}
+
+func NewWebhookDispatcher(db *sql.DB, interval, timeout time.Duration, maxAttempts int) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:          db,
+		client:      newOutboundClient(timeout),
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		timeout:     timeout,
+	}
+}
+
+func (wd *WebhookDispatcher) Start(ctx context.Context) {
+	log.Printf("Webhook dispatcher started: poll every %v, max %d attempts", wd.interval, wd.maxAttempts)
+
+	ticker := time.NewTicker(wd.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := wd.RunOnce(ctx)
+			if err != nil {
+				log.Printf("Webhook dispatch failed: %v", err)
+			}
+			// Полная пачка - возможно, в очереди есть ещё
+			if err != nil || n < webhookBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+// RunOnce захватывает пачку готовых доставок и отправляет их.
+// Доставки пачки идут по очереди, каждая не дольше timeout, поэтому аренда рассчитана
+// на всю пачку с запасом: иначе последние строки успел бы повторно захватить другой экземпляр
+func (wd *WebhookDispatcher) RunOnce(ctx context.Context) (int, error) {
+	lease := time.Now().UTC().Add(time.Duration(webhookBatchSize+1) * wd.timeout)
+	rows, err := wd.db.QueryContext(ctx,
+		`UPDATE webhook_deliveries d SET next_attempt_at = $1
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.event_type, d.payload, d.attempts, w.url, w.secret`,
+		lease, webhookBatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var jobs []webhookJob
+	for rows.Next() {
+		var j webhookJob
+		if err := rows.Scan(&j.id, &j.event, &j.payload, &j.attempts, &j.url, &j.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		jobs = append(jobs, j)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, j := range jobs {
+		if ctx.Err() != nil {
+			return len(jobs), ctx.Err()
+		}
+		wd.deliver(ctx, j)
+	}
+	return len(jobs), nil
+}
+
+func (wd *WebhookDispatcher) send(ctx context.Context, j webhookJob) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.url, bytes.NewReader(j.payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AI-Detector-Webhook/1.0")
+	req.Header.Set("X-Webhook-Event", j.event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(j.id, 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(j.secret, ts, j.payload))
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyLimit))
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+func (wd *WebhookDispatcher) deliver(ctx context.Context, j webhookJob) {
+	start := time.Now()
+	code, sendErr := wd.send(ctx, j)
+	duration := time.Since(start)
+
+	var statusCode sql.NullInt64
+	if code != 0 {
+		statusCode = sql.NullInt64{Int64: int64(code), Valid: true}
+	}
+	errText := ""
+	if sendErr != nil {
+		errText = sendErr.Error()
+	}
+
+	attempts := j.attempts + 1
+	now := time.Now().UTC()
+	status := models.DeliveryDelivered
+	next := now
+	var deliveredAt sql.NullTime
+	switch {
+	case sendErr == nil:
+		deliveredAt = sql.NullTime{Time: now, Valid: true}
+	case attempts >= wd.maxAttempts:
+		status = models.DeliveryFailed
+		log.Printf("Webhook delivery %d failed permanently after %d attempts: %v", j.id, attempts, sendErr)
+	default:
+		status = models.DeliveryPending
+		next = now.Add(webhookBackoff(attempts))
+	}
+
+	// Результат пишем даже при остановке сервера, иначе попытка потеряется из журнала
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if _, err := wd.db.ExecContext(saveCtx,
+		"INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms) VALUES ($1, $2, $3, $4)",
+		j.id, statusCode, errText, duration.Milliseconds(),
+	); err != nil {
+		log.Printf("Failed to log webhook attempt %d: %v", j.id, err)
+	}
+	if _, err := wd.db.ExecContext(saveCtx,
+		`UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3,
+			last_status_code = $4, last_error = $5, delivered_at = $6
+		WHERE id = $7`,
+		status, attempts, next, statusCode, errText, deliveredAt, j.id,
+	); err != nil {
+		log.Printf("Failed to update webhook delivery %d: %v", j.id, err)
+	}
+}
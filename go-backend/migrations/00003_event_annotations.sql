@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Разметка событий: либо конкретное событие, либо интервал времени в сеансе
+CREATE TABLE IF NOT EXISTS event_annotations (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    event_id INTEGER REFERENCES events(id) ON DELETE CASCADE,
+    start_time TIMESTAMP WITH TIME ZONE,
+    end_time TIMESTAMP WITH TIME ZONE,
+    label TEXT NOT NULL CHECK (label IN ('true_positive', 'false_positive', 'unknown')),
+    comment TEXT NOT NULL DEFAULT '',
+    author_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (event_id IS NOT NULL OR (start_time IS NOT NULL AND end_time IS NOT NULL AND start_time <= end_time))
+);
+
+CREATE INDEX IF NOT EXISTS idx_annotations_session ON event_annotations(session_id);
+CREATE INDEX IF NOT EXISTS idx_annotations_event ON event_annotations(event_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_annotations_event;
+DROP INDEX IF EXISTS idx_annotations_session;
+DROP TABLE IF EXISTS event_annotations;
+-- +goose StatementEnd
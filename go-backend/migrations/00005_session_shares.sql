@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ссылки для просмотра сеанса без учётной записи. Сам токен не хранится:
+-- он подписан HMAC и содержит id ссылки и срок действия
+CREATE TABLE IF NOT EXISTS session_shares (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    label TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS share_access_log (
+    id BIGSERIAL PRIMARY KEY,
+    share_id INTEGER NOT NULL REFERENCES session_shares(id) ON DELETE CASCADE,
+    resource TEXT NOT NULL,
+    result TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    accessed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_shares_session ON session_shares(session_id);
+CREATE INDEX IF NOT EXISTS idx_share_access_share ON share_access_log(share_id, accessed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_share_access_share;
+DROP INDEX IF EXISTS idx_shares_session;
+DROP TABLE IF EXISTS share_access_log;
+DROP TABLE IF EXISTS session_shares;
+-- +goose StatementEnd
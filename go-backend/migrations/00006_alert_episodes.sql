@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Эпизоды тревоги, выделенные сервером из потока результатов детекции
+CREATE TABLE IF NOT EXISTS alert_episodes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id INTEGER REFERENCES sessions(id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL DEFAULT '',
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE,
+    peak_score REAL NOT NULL,
+    severity TEXT NOT NULL CHECK (severity IN ('low', 'medium', 'high')),
+    frames INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_episodes_user_time ON alert_episodes(user_id, start_time);
+CREATE INDEX IF NOT EXISTS idx_alert_episodes_session ON alert_episodes(session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_alert_episodes_session;
+DROP INDEX IF EXISTS idx_alert_episodes_user_time;
+DROP TABLE IF EXISTS alert_episodes;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Скользящие метрики глаз на момент события (NULL для старых событий)
+ALTER TABLE events ADD COLUMN IF NOT EXISTS perclos REAL;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS blink_rate REAL;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS long_blinks INTEGER;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE events DROP COLUMN IF EXISTS long_blinks;
+ALTER TABLE events DROP COLUMN IF EXISTS blink_rate;
+ALTER TABLE events DROP COLUMN IF EXISTS perclos;
+-- +goose StatementEnd
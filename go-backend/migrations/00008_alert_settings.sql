@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Настройки тревоги: либо для пользователя, либо значение по умолчанию для организации
+CREATE TABLE IF NOT EXISTS alert_settings (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER UNIQUE REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INTEGER UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    score_threshold REAL NOT NULL CHECK (score_threshold > 0 AND score_threshold <= 1),
+    min_duration_ms INTEGER NOT NULL DEFAULT 0 CHECK (min_duration_ms >= 0),
+    cooldown_sec INTEGER NOT NULL DEFAULT 0 CHECK (cooldown_sec >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((organization_id IS NULL) <> (user_id IS NULL))
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_settings;
+-- +goose StatementEnd
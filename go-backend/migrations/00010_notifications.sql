@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Подписка пользователя на уведомления по каналу (email, чат-бот, webhook).
+-- Наблюдаемые: конкретный пользователь, организация или, если оба пусты, сам подписчик
+CREATE TABLE IF NOT EXISTS notification_subscriptions (
+    id SERIAL PRIMARY KEY,
+    subscriber_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel TEXT NOT NULL,
+    target TEXT NOT NULL,
+    events TEXT NOT NULL,
+    watch_user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    watch_organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+    subject_template TEXT NOT NULL DEFAULT '',
+    body_template TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (watch_user_id IS NULL OR watch_organization_id IS NULL)
+);
+
+CREATE TABLE IF NOT EXISTS notification_log (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES notification_subscriptions(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 1,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_subs_subscriber ON notification_subscriptions(subscriber_id);
+CREATE INDEX IF NOT EXISTS idx_notification_subs_watch_user ON notification_subscriptions(watch_user_id);
+CREATE INDEX IF NOT EXISTS idx_notification_subs_watch_org ON notification_subscriptions(watch_organization_id);
+CREATE INDEX IF NOT EXISTS idx_notification_log_subscription ON notification_log(subscription_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_notification_log_subscription;
+DROP INDEX IF EXISTS idx_notification_subs_watch_org;
+DROP INDEX IF EXISTS idx_notification_subs_watch_user;
+DROP INDEX IF EXISTS idx_notification_subs_subscriber;
+DROP TABLE IF EXISTS notification_log;
+DROP TABLE IF EXISTS notification_subscriptions;
+-- +goose StatementEnd
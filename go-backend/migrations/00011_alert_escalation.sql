@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Подтверждение тревоги водителем и достигнутый уровень эскалации
+ALTER TABLE alert_episodes ADD COLUMN IF NOT EXISTS acknowledged_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE alert_episodes ADD COLUMN IF NOT EXISTS ack_latency_ms BIGINT;
+ALTER TABLE alert_episodes ADD COLUMN IF NOT EXISTS escalation_level INTEGER NOT NULL DEFAULT 0;
+
+-- Журнал шагов эскалации неподтверждённых тревог
+CREATE TABLE IF NOT EXISTS alert_escalations (
+    id BIGSERIAL PRIMARY KEY,
+    episode_id INTEGER NOT NULL REFERENCES alert_episodes(id) ON DELETE CASCADE,
+    level INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Экстренный контакт водителя - последний шаг эскалации
+CREATE TABLE IF NOT EXISTS emergency_contacts (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    channel TEXT NOT NULL,
+    target TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_escalations_episode ON alert_escalations(episode_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_alert_escalations_episode;
+DROP TABLE IF EXISTS emergency_contacts;
+DROP TABLE IF EXISTS alert_escalations;
+ALTER TABLE alert_episodes DROP COLUMN IF EXISTS escalation_level;
+ALTER TABLE alert_episodes DROP COLUMN IF EXISTS ack_latency_ms;
+ALTER TABLE alert_episodes DROP COLUMN IF EXISTS acknowledged_at;
+-- +goose StatementEnd
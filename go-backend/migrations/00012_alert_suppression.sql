@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Транспортное средство и состояние сеанса (движение, стоянка, погрузка, калибровка)
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS vehicle_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT 'driving'
+    CHECK (state IN ('driving', 'parking', 'loading', 'calibration'));
+
+-- Правила подавления тревог для пользователя или транспортного средства:
+-- window - разовый интервал, daily - ежедневный интервал по местному времени,
+-- session_state - пока сеанс в одном из перечисленных состояний
+CREATE TABLE IF NOT EXISTS suppression_rules (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    vehicle_id TEXT,
+    kind TEXT NOT NULL CHECK (kind IN ('window', 'daily', 'session_state')),
+    starts_at TIMESTAMP WITH TIME ZONE,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    daily_start TEXT NOT NULL DEFAULT '',
+    daily_end TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    states TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL DEFAULT 'api' CHECK (source IN ('api', 'command')),
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (vehicle_id IS NULL))
+);
+
+-- Тревоги, не отправленные из-за правил подавления; хранятся для аудита
+CREATE TABLE IF NOT EXISTS suppressed_alerts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id INTEGER REFERENCES sessions(id) ON DELETE CASCADE,
+    rule_id INTEGER REFERENCES suppression_rules(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    client_id TEXT NOT NULL DEFAULT '',
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE,
+    peak_score REAL NOT NULL,
+    severity TEXT NOT NULL,
+    frames INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_suppression_rules_user ON suppression_rules(user_id);
+CREATE INDEX IF NOT EXISTS idx_suppression_rules_vehicle ON suppression_rules(vehicle_id);
+CREATE INDEX IF NOT EXISTS idx_suppressed_alerts_user_time ON suppressed_alerts(user_id, start_time);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_suppressed_alerts_user_time;
+DROP INDEX IF EXISTS idx_suppression_rules_vehicle;
+DROP INDEX IF EXISTS idx_suppression_rules_user;
+DROP TABLE IF EXISTS suppressed_alerts;
+DROP TABLE IF EXISTS suppression_rules;
+ALTER TABLE sessions DROP COLUMN IF EXISTS state;
+ALTER TABLE sessions DROP COLUMN IF EXISTS vehicle_id;
+-- +goose StatementEnd
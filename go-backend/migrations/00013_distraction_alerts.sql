@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Тип тревоги (сонливость или отвлечение) и причина отвлечения: взгляд в сторону или голова опущена
+ALTER TABLE alert_episodes ADD COLUMN IF NOT EXISTS alert_type TEXT NOT NULL DEFAULT 'DROWSINESS'
+    CHECK (alert_type IN ('DROWSINESS', 'DISTRACTION'));
+ALTER TABLE alert_episodes ADD COLUMN IF NOT EXISTS reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE suppressed_alerts ADD COLUMN IF NOT EXISTS alert_type TEXT NOT NULL DEFAULT 'DROWSINESS';
+
+CREATE INDEX IF NOT EXISTS idx_alert_episodes_user_type_time ON alert_episodes(user_id, alert_type, start_time);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_alert_episodes_user_type_time;
+ALTER TABLE suppressed_alerts DROP COLUMN IF EXISTS alert_type;
+ALTER TABLE alert_episodes DROP COLUMN IF EXISTS reason;
+ALTER TABLE alert_episodes DROP COLUMN IF EXISTS alert_type;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Сглаживание покадровой оценки сонливости: метод (EMA или медиана окна), его параметры
+-- и гистерезис - насколько оценка должна опуститься ниже порога, чтобы кадр снова считался бодрым
+ALTER TABLE alert_settings ADD COLUMN IF NOT EXISTS smoothing_method TEXT NOT NULL DEFAULT 'ema'
+    CHECK (smoothing_method IN ('none', 'ema', 'median'));
+ALTER TABLE alert_settings ADD COLUMN IF NOT EXISTS smoothing_alpha REAL NOT NULL DEFAULT 0.3
+    CHECK (smoothing_alpha > 0 AND smoothing_alpha <= 1);
+ALTER TABLE alert_settings ADD COLUMN IF NOT EXISTS smoothing_window INTEGER NOT NULL DEFAULT 5
+    CHECK (smoothing_window >= 1);
+ALTER TABLE alert_settings ADD COLUMN IF NOT EXISTS hysteresis REAL NOT NULL DEFAULT 0.1
+    CHECK (hysteresis >= 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE alert_settings DROP COLUMN IF EXISTS hysteresis;
+ALTER TABLE alert_settings DROP COLUMN IF EXISTS smoothing_window;
+ALTER TABLE alert_settings DROP COLUMN IF EXISTS smoothing_alpha;
+ALTER TABLE alert_settings DROP COLUMN IF EXISTS smoothing_method;
+-- +goose StatementEnd
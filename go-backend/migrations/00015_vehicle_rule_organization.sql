@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Правило транспортного средства действует только для водителей организации, в которой создано:
+-- vehicle_id - произвольная строка и может совпасть у разных организаций
+ALTER TABLE suppression_rules ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+UPDATE suppression_rules r SET organization_id = u.organization_id
+    FROM users u WHERE r.vehicle_id IS NOT NULL AND u.id = r.created_by;
+CREATE INDEX IF NOT EXISTS idx_suppression_rules_org_vehicle ON suppression_rules(organization_id, vehicle_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_suppression_rules_org_vehicle;
+ALTER TABLE suppression_rules DROP COLUMN IF EXISTS organization_id;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Восстановленные из архива события не архивируются повторно заданием хранения
+ALTER TABLE events ADD COLUMN IF NOT EXISTS restored_from_archive_id INTEGER REFERENCES event_archives(id) ON DELETE SET NULL;
+
+-- Сеансы архива, уже восстановленные: прерванное восстановление продолжается с того же места
+CREATE TABLE IF NOT EXISTS event_archive_sessions (
+    archive_id INTEGER NOT NULL REFERENCES event_archives(id) ON DELETE CASCADE,
+    archived_session_id INTEGER NOT NULL,
+    session_id INTEGER REFERENCES sessions(id) ON DELETE SET NULL,
+    events_count INTEGER NOT NULL DEFAULT 0,
+    restored_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (archive_id, archived_session_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS event_archive_sessions;
+ALTER TABLE events DROP COLUMN IF EXISTS restored_from_archive_id;
+-- +goose StatementEnd